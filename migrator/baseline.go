@@ -0,0 +1,98 @@
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Baseline marks every migration up to and including the given version as applied without running its script.
+// With ReportNoChange set, it returns ErrNoChange when all of them were already applied.
+func (m *Migrator) Baseline(version string) error {
+	return m.noChange(m.baseline(version))
+}
+
+func (m *Migrator) baseline(version string) error {
+	if version == "" {
+		return fmt.Errorf("baseline version cannot be empty")
+	}
+
+	release, err := m.lock()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := m.checkDirty(); err != nil {
+		return err
+	}
+
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	appliedMigrations, err := m.appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	var records []interface{}
+	var found bool
+	now := time.Now()
+	for _, mig := range migrations {
+		if mig.Version > version {
+			break
+		}
+		if mig.Version == version {
+			found = true
+		}
+		if mig.UpPath == "" || appliedMigrations[mig.Version] {
+			continue
+		}
+
+		records = append(records, MigrationRecord{
+			Version:   mig.Version,
+			AppliedAt: now,
+			Baselined: true,
+			Stream:    m.Stream,
+		})
+	}
+
+	if !found {
+		return fmt.Errorf("baseline version %s not found in script directory", version)
+	}
+
+	if len(records) == 0 {
+		return ErrNoChange
+	}
+
+	collection := m.dbClient.Database(m.DBName).Collection("migrations")
+	if _, err := collection.InsertMany(context.Background(), records); err != nil {
+		return fmt.Errorf("failed to record baseline: %w", err)
+	}
+
+	return nil
+}
+
+// History returns the records in the migrations collection ordered by version
+func (m *Migrator) History() ([]MigrationRecord, error) {
+	collection := m.dbClient.Database(m.DBName).Collection("migrations")
+
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: 1}})
+	cursor, err := collection.Find(context.Background(), m.scope(bson.M{}), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch migration history: %w", err)
+	}
+	defer cursor.Close(context.Background())
+
+	var records []MigrationRecord
+	if err := cursor.All(context.Background(), &records); err != nil {
+		return nil, fmt.Errorf("failed to decode migration history: %w", err)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,105 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Callback scripts discovered in the scripts directory
+const (
+	beforeMigrateScript     = "beforeMigrate.js"
+	afterMigrateScript      = "afterMigrate.js"
+	beforeEachScript        = "beforeEach.js"
+	afterEachScript         = "afterEach.js"
+	afterMigrateErrorScript = "afterMigrateError.js"
+)
+
+// Hooks are Go callbacks invoked around migration runs, next to the callback scripts of the scripts directory.
+// A Go hook runs after the callback script of the same name.
+type Hooks struct {
+	// BeforeMigrate runs before Up, Down or DownTo apply anything
+	BeforeMigrate func() error
+	// AfterMigrate runs after a successful run
+	AfterMigrate func() error
+	// BeforeEach runs before every migration script with its version or repeatable name
+	BeforeEach func(version string) error
+	// AfterEach runs after every successful migration script with its version or repeatable name
+	AfterEach func(version string) error
+	// AfterMigrateError runs after a failed run with the error that stopped it
+	AfterMigrateError func(err error) error
+}
+
+// withCallbacks wraps a run with the beforeMigrate, afterMigrate and afterMigrateError callbacks
+func (m *Migrator) withCallbacks(run func() error) error {
+	err := m.callback(beforeMigrateScript, m.Hooks.BeforeMigrate)
+	if err == nil {
+		err = run()
+	}
+	// A run that had nothing to do still succeeded
+	if err == nil || errors.Is(err, ErrNoChange) {
+		if cbErr := m.callback(afterMigrateScript, m.Hooks.AfterMigrate); cbErr != nil {
+			err = cbErr
+		}
+	}
+
+	if err != nil && !errors.Is(err, ErrNoChange) {
+		// Cleanup must run even when the run failed, its own failure is reported alongside the original error
+		var hook func() error
+		if m.Hooks.AfterMigrateError != nil {
+			hook = func() error { return m.Hooks.AfterMigrateError(err) }
+		}
+		if cbErr := m.callback(afterMigrateErrorScript, hook); cbErr != nil {
+			return errors.Join(err, cbErr)
+		}
+		return err
+	}
+
+	return err
+}
+
+// withEachCallbacks wraps a single migration step with the beforeEach and afterEach callbacks
+func (m *Migrator) withEachCallbacks(version string, step func() error) error {
+	var before, after func() error
+	if m.Hooks.BeforeEach != nil {
+		before = func() error { return m.Hooks.BeforeEach(version) }
+	}
+	if m.Hooks.AfterEach != nil {
+		after = func() error { return m.Hooks.AfterEach(version) }
+	}
+
+	if err := m.callback(beforeEachScript, before); err != nil {
+		return err
+	}
+
+	if err := step(); err != nil {
+		return err
+	}
+
+	return m.callback(afterEachScript, after)
+}
+
+// callback runs the named callback script if it exists, followed by the Go hook if it is set
+func (m *Migrator) callback(scriptName string, hook func() error) error {
+	scriptPath := filepath.Join(m.ScriptDir, scriptName)
+	if _, err := os.Stat(scriptPath); err == nil {
+		hdr, err := m.parseHeader(scriptPath)
+		if err != nil {
+			return err
+		}
+		if _, err := m.runScript(scriptPath, hdr); err != nil {
+			return fmt.Errorf("callback %s failed: %w", scriptName, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to stat callback %s: %w", scriptName, err)
+	}
+
+	if hook != nil {
+		if err := hook(); err != nil {
+			return fmt.Errorf("hook for %s failed: %w", scriptName, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package migrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Target is a cluster migrated by a ClusterRunner
+type Target struct {
+	Name   string `json:"name"`
+	URI    string `json:"uri"`
+	DBName string `json:"db"`
+	// Username and Password are used when the URI carries no credentials.
+	// PasswordEnv names an environment variable holding the password, so config files need not contain it.
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	PasswordEnv string `json:"passwordEnv,omitempty"`
+}
+
+// ClusterResult is the outcome of a run on a single cluster
+type ClusterResult struct {
+	Target string
+	RunResult
+}
+
+// ClusterRunner applies the same migrations to several clusters, each with its own connection
+type ClusterRunner struct {
+	Targets   []Target
+	ScriptDir string
+	// Parallel migrates all clusters at once instead of one after the other
+	Parallel bool
+	// Configure is called with the migrator of every cluster before it runs
+	Configure func(target Target, m *Migrator)
+	// Logger is the logger of every cluster, with a cluster attribute added. It defaults to a text logger writing to stdout.
+	Logger *slog.Logger
+}
+
+// LoadTargets reads a JSON array of targets from a config file
+func LoadTargets(path string) ([]Target, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read targets: %w", err)
+	}
+
+	var targets []Target
+	if err := json.Unmarshal(content, &targets); err != nil {
+		return nil, fmt.Errorf("failed to parse targets: %w", err)
+	}
+
+	for i, target := range targets {
+		if target.URI == "" || target.DBName == "" {
+			return nil, fmt.Errorf("target %d (%s) needs a uri and a db", i, target.Name)
+		}
+		if target.Name == "" {
+			targets[i].Name = redactURI(target.URI)
+		}
+	}
+
+	return targets, nil
+}
+
+// Up applies pending migrations to every cluster
+func (r *ClusterRunner) Up(ctx context.Context) ([]ClusterResult, error) {
+	return r.Run(ctx, (*Migrator).Up)
+}
+
+// Run calls fn with the migrator of every cluster and returns the result of each cluster in target order.
+// A failing cluster never stops the others, the returned error joins the errors of all failed clusters.
+// The migrators have ReportNoChange set, fn returns ErrNoChange when a cluster had nothing to do.
+func (r *ClusterRunner) Run(ctx context.Context, fn func(*Migrator) error) ([]ClusterResult, error) {
+	results := make([]ClusterResult, len(r.Targets))
+
+	var wg sync.WaitGroup
+	for i, target := range r.Targets {
+		if !r.Parallel {
+			results[i] = r.runTarget(ctx, target, fn)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, target Target) {
+			defer wg.Done()
+			results[i] = r.runTarget(ctx, target, fn)
+		}(i, target)
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+
+	return results, errors.Join(errs...)
+}
+
+// runTarget connects to a single cluster, runs fn and records its versions before and after
+func (r *ClusterRunner) runTarget(ctx context.Context, target Target, fn func(*Migrator) error) ClusterResult {
+	open := func() (*Migrator, func(), error) {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		m, err := NewMigrator(target.clientOptions(), target.DBName, r.ScriptDir)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		m.Logger = loggerOrDefault(r.Logger).With("cluster", target.Name)
+		if r.Configure != nil {
+			r.Configure(target, m)
+		}
+		return m, func() { m.dbClient.Disconnect(context.Background()) }, nil
+	}
+	return ClusterResult{Target: target.Name, RunResult: runMigrator("cluster "+target.Name, open, fn)}
+}
+
+// clientOptions builds the client options of a target, adding its credentials when set
+func (t Target) clientOptions() *options.ClientOptions {
+	opts := options.Client().ApplyURI(t.URI)
+
+	password := t.Password
+	if t.PasswordEnv != "" {
+		password = os.Getenv(t.PasswordEnv)
+	}
+	if t.Username != "" {
+		opts.SetAuth(options.Credential{Username: t.Username, Password: password})
+	}
+
+	return opts
+}
+
+// WriteClusterReport writes a table of the per-cluster results
+func WriteClusterReport(w io.Writer, results []ClusterResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLUSTER\tBEFORE\tAFTER\tDURATION\tRESULT")
+	for _, result := range results {
+		outcome := "unchanged"
+		switch {
+		case result.Err != nil:
+			outcome = "failed: " + result.Err.Error()
+		case result.Changed:
+			outcome = "migrated"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", result.Target, versionOrNone(result.VersionBefore),
+			versionOrNone(result.VersionAfter), result.Duration.Round(time.Millisecond), outcome)
+	}
+	return tw.Flush()
+}
+
+func versionOrNone(version string) string {
+	if version == "" {
+		return "-"
+	}
+	return version
+}
@@ -0,0 +1,84 @@
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// commandWaitDelay is how long a timed out shell migration may keep its output open before it is closed
+const commandWaitDelay = 5 * time.Second
+
+// commandStep checks a shell migration such as 040_up_clean_addresses.sh and returns the function executing it,
+// honoring the timeout of its header. Executable files are run directly so their shebang line picks the interpreter,
+// others are run with sh. The connection details are passed in environment variables rather than on the command line.
+func (m *Migrator) commandStep(scriptPath string, hdr header, version, direction string) (stepFunc, error) {
+	if err := m.checkServerVersion(hdr.RequiresServer); err != nil {
+		return nil, fmt.Errorf("cannot run script %s: %w", scriptPath, err)
+	}
+
+	env, err := m.commandEnv(version, direction)
+	if err != nil {
+		return nil, err
+	}
+
+	// An absolute path keeps a script in the working directory from being looked up in PATH
+	absPath, err := filepath.Abs(scriptPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve script %s: %w", scriptPath, err)
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat script %s: %w", scriptPath, err)
+	}
+
+	return func() (outcome, error) {
+		ctx := context.Background()
+		if hdr.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, hdr.Timeout)
+			defer cancel()
+		}
+
+		var cmd *exec.Cmd
+		if info.Mode()&0o111 != 0 {
+			cmd = exec.CommandContext(ctx, absPath)
+		} else {
+			cmd = exec.CommandContext(ctx, "sh", absPath)
+		}
+		cmd.Env = append(os.Environ(), env...)
+		setProcessGroup(cmd)
+		// Children that left the process group may keep the output open after the timeout
+		cmd.WaitDelay = commandWaitDelay
+
+		output, err := m.runProcess(ctx, cmd, scriptPath, hdr)
+		return outcome{Output: output}, err
+	}, nil
+}
+
+// commandEnv returns the environment variables describing the migration and its database to a shell migration
+func (m *Migrator) commandEnv(version, direction string) ([]string, error) {
+	env := []string{
+		"MONGODB_URI=" + m.connectionURI(),
+		"MONGODB_DATABASE=" + m.DBName,
+		"MIGRONGO_VERSION=" + version,
+		"MIGRONGO_DIRECTION=" + direction,
+		"MIGRONGO_STREAM=" + m.Stream,
+		"MIGRONGO_ENVIRONMENT=" + m.Environment,
+	}
+
+	if m.Params != nil {
+		params, err := bson.MarshalExtJSON(m.Params, true, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode params: %w", err)
+		}
+		env = append(env, "MIGRONGO_PARAMS="+string(params))
+	}
+
+	return env, nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package migrator
+
+import "os/exec"
+
+// setProcessGroup is a no-op on platforms without process groups, only the command itself is killed on timeout
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,106 @@
+package migrator
+
+import (
+	"net/url"
+	"strings"
+)
+
+// redactedPassword replaces passwords in URIs and error messages
+const redactedPassword = "xxxxx"
+
+// connectionURI returns the URI mongosh connects with, including the credentials of the client options
+// when the URI itself has none. It must only be written to files readable by the current user.
+func (m *Migrator) connectionURI() string {
+	uri := m.MongoClientOptions.GetURI()
+
+	auth := m.MongoClientOptions.Auth
+	if auth == nil || auth.Username == "" || uriUserInfo(uri) != "" {
+		return uri
+	}
+
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return uri
+	}
+
+	userInfo := url.UserPassword(auth.Username, auth.Password).String()
+	return scheme + "://" + userInfo + "@" + rest
+}
+
+// redactURI masks the password of a connection string
+func redactURI(uri string) string {
+	userInfo := uriUserInfo(uri)
+	user, _, hasPassword := strings.Cut(userInfo, ":")
+	if !hasPassword {
+		return uri
+	}
+
+	return strings.Replace(uri, userInfo+"@", user+":"+redactedPassword+"@", 1)
+}
+
+// uriUserInfo returns the user information of a connection string, e.g. user:pass
+func uriUserInfo(uri string) string {
+	_, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return ""
+	}
+
+	// The user information ends at the last @ before the path
+	authority, _, _ := strings.Cut(rest, "/")
+	at := strings.LastIndex(authority, "@")
+	if at < 0 {
+		return ""
+	}
+
+	return authority[:at]
+}
+
+// redactedError hides a password in the message of the wrapped error while keeping it inspectable with errors.Is and errors.As
+type redactedError struct {
+	err    error
+	secret string
+}
+
+func (e *redactedError) Error() string {
+	return strings.ReplaceAll(e.err.Error(), e.secret, redactedPassword)
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactError wraps an error so that the password of the given URI never appears in its message
+func redactError(err error, uri string) error {
+	if err == nil {
+		return nil
+	}
+
+	for _, secret := range uriSecrets(uri) {
+		err = &redactedError{err: err, secret: secret}
+	}
+
+	return err
+}
+
+// redactString masks the password of the given URI in a string such as captured script output
+func redactString(s, uri string) string {
+	for _, secret := range uriSecrets(uri) {
+		s = strings.ReplaceAll(s, secret, redactedPassword)
+	}
+	return s
+}
+
+// uriSecrets returns the password of a connection string in its escaped and unescaped forms
+func uriSecrets(uri string) []string {
+	_, password, ok := strings.Cut(uriUserInfo(uri), ":")
+	if !ok || password == "" {
+		return nil
+	}
+
+	secrets := []string{password}
+	if unescaped, err := url.PathUnescape(password); err == nil && unescaped != password {
+		secrets = append(secrets, unescaped)
+	}
+
+	return secrets
+}
@@ -0,0 +1,216 @@
+package migrator
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// dependencies returns the versions every migration depends on. A migration without @depends-on
+// depends on the previous version, so scripts without directives keep their linear order.
+// Declared dependencies on versions consolidated by Squash are replaced by the squashed migration.
+func dependencies(migrations []*migration) (map[string][]string, error) {
+	known := make(map[string]bool, len(migrations))
+	for _, mig := range migrations {
+		known[mig.Version] = true
+	}
+
+	deps := make(map[string][]string, len(migrations))
+	for i, mig := range migrations {
+		switch {
+		case len(mig.Header.DependsOn) > 0:
+			var resolved []string
+			for _, dep := range mig.Header.DependsOn {
+				if !known[dep] {
+					squash := squashCovering(migrations, dep)
+					if squash == nil {
+						return nil, fmt.Errorf("migration %s depends on unknown migration %s", mig.Version, dep)
+					}
+					dep = squash.Version
+				}
+				if dep != mig.Version && !slices.Contains(resolved, dep) {
+					resolved = append(resolved, dep)
+				}
+			}
+			mig.Header.DependsOn = resolved
+			deps[mig.Version] = resolved
+		case i > 0:
+			deps[mig.Version] = []string{migrations[i-1].Version}
+		}
+	}
+
+	return deps, nil
+}
+
+// topoSort orders migrations so that every migration comes after its dependencies.
+// Among migrations that are ready at the same time the lowest version comes first.
+func topoSort(migrations []*migration, deps map[string][]string) ([]*migration, error) {
+	byVersion := make(map[string]*migration, len(migrations))
+	remaining := make(map[string]int, len(migrations))
+	dependents := make(map[string][]string)
+	for _, mig := range migrations {
+		byVersion[mig.Version] = mig
+		remaining[mig.Version] = len(deps[mig.Version])
+		for _, dep := range deps[mig.Version] {
+			dependents[dep] = append(dependents[dep], mig.Version)
+		}
+	}
+
+	var ready []string
+	for version, count := range remaining {
+		if count == 0 {
+			ready = append(ready, version)
+		}
+	}
+
+	sorted := make([]*migration, 0, len(migrations))
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		version := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, byVersion[version])
+
+		for _, dependent := range dependents[version] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if len(sorted) != len(migrations) {
+		var cycle []string
+		for version, count := range remaining {
+			if count > 0 {
+				cycle = append(cycle, version)
+			}
+		}
+		sort.Strings(cycle)
+		return nil, fmt.Errorf("migration dependencies contain a cycle between %s", strings.Join(cycle, ", "))
+	}
+
+	return sorted, nil
+}
+
+// plannedMigrations returns the migrations of the scripts directory in dependency order, and their dependencies
+func (m *Migrator) plannedMigrations() ([]*migration, map[string][]string, error) {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var versioned []*migration
+	for _, mig := range migrations {
+		if mig.UpPath != "" {
+			versioned = append(versioned, mig)
+		}
+	}
+
+	deps, err := dependencies(versioned)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sorted, err := topoSort(versioned, deps)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Down-only versions have no place in the graph, they keep their version order at the end
+	for _, mig := range migrations {
+		if mig.UpPath == "" {
+			sorted = append(sorted, mig)
+		}
+	}
+
+	return sorted, deps, nil
+}
+
+// applyConcurrently applies pending migrations, given in dependency order, with up to Workers at once,
+// starting each one as soon as all of its dependencies are applied. No migration is started after the first failure.
+func (m *Migrator) applyConcurrently(pending []*migration, deps map[string][]string, applied map[string]bool, apply func(*migration) error) error {
+	isPending := make(map[string]bool, len(pending))
+	for _, mig := range pending {
+		isPending[mig.Version] = true
+	}
+
+	// Migrations skipped by this run, e.g. by a filter, pass the wait on to their own dependencies
+	var pendingDeps func(version string, seen map[string]bool) []string
+	pendingDeps = func(version string, seen map[string]bool) []string {
+		var found []string
+		for _, dep := range deps[version] {
+			if seen[dep] || applied[dep] {
+				continue
+			}
+			seen[dep] = true
+			if isPending[dep] {
+				found = append(found, dep)
+			} else {
+				found = append(found, pendingDeps(dep, seen)...)
+			}
+		}
+		return found
+	}
+
+	waiting := make(map[string]int, len(pending))
+	dependents := make(map[string][]*migration)
+	for _, mig := range pending {
+		for _, dep := range pendingDeps(mig.Version, map[string]bool{}) {
+			waiting[mig.Version]++
+			dependents[dep] = append(dependents[dep], mig)
+		}
+	}
+
+	var ready []*migration
+	for _, mig := range pending {
+		if waiting[mig.Version] == 0 {
+			ready = append(ready, mig)
+		}
+	}
+
+	type result struct {
+		mig *migration
+		err error
+	}
+	results := make(chan result)
+	var wg sync.WaitGroup
+	var errs []error
+	running := 0
+
+	for len(ready) > 0 || running > 0 {
+		for len(errs) == 0 && len(ready) > 0 && running < m.Workers {
+			mig := ready[0]
+			ready = ready[1:]
+			running++
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results <- result{mig: mig, err: apply(mig)}
+			}()
+		}
+		if running == 0 {
+			break
+		}
+
+		res := <-results
+		running--
+		if res.err != nil {
+			errs = append(errs, res.err)
+			continue
+		}
+		for _, dependent := range dependents[res.mig.Version] {
+			waiting[dependent.Version]--
+			if waiting[dependent.Version] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package migrator
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testMigrations builds migrations from versions, each optionally followed by its @depends-on list, e.g. "003:001,002"
+func testMigrations(specs ...string) []*migration {
+	migrations := make([]*migration, 0, len(specs))
+	for _, spec := range specs {
+		version, dependsOn, _ := strings.Cut(spec, ":")
+		migrations = append(migrations, &migration{
+			Version: version,
+			Kind:    scriptMigration,
+			UpPath:  version + "_up_test.js",
+			Header:  header{DependsOn: splitList(dependsOn)},
+		})
+	}
+	return migrations
+}
+
+func versionsOf(migrations []*migration) []string {
+	versions := make([]string, 0, len(migrations))
+	for _, mig := range migrations {
+		versions = append(versions, mig.Version)
+	}
+	return versions
+}
+
+func TestDependencies(t *testing.T) {
+	deps, err := dependencies(testMigrations("001", "002", "003:001", "004"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"002": {"001"},
+		"003": {"001"},
+		"004": {"003"},
+	}
+	for version, wantDeps := range want {
+		if !slices.Equal(deps[version], wantDeps) {
+			t.Errorf("dependencies of %s = %v, want %v", version, deps[version], wantDeps)
+		}
+	}
+	if len(deps["001"]) != 0 {
+		t.Errorf("dependencies of 001 = %v, want none", deps["001"])
+	}
+}
+
+func TestDependenciesUnknown(t *testing.T) {
+	_, err := dependencies(testMigrations("001", "002:009"))
+	if err == nil || !strings.Contains(err.Error(), "unknown migration 009") {
+		t.Errorf("dependencies() error = %v, want unknown migration 009", err)
+	}
+}
+
+func TestDependenciesOnSquashedVersions(t *testing.T) {
+	migrations := testMigrations("150", "151:100,120,150")
+	migrations[0].UpPath = squashedScriptName("001", "150", "up")
+
+	deps, err := dependencies(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(deps["151"], []string{"150"}) {
+		t.Errorf("dependencies of 151 = %v, want [150]", deps["151"])
+	}
+}
+
+func TestTopoSort(t *testing.T) {
+	tests := []struct {
+		name  string
+		specs []string
+		want  []string
+	}{
+		{"linear", []string{"001", "002", "003"}, []string{"001", "002", "003"}},
+		{"explicit dependency moves a migration later", []string{"001", "002:003", "003:001"}, []string{"001", "003", "002"}},
+		{"ties start with the lowest version", []string{"003:001", "002:001", "001", "004:002,003"}, []string{"001", "002", "003", "004"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations := testMigrations(tt.specs...)
+			slices.SortFunc(migrations, func(a, b *migration) int { return strings.Compare(a.Version, b.Version) })
+
+			deps, err := dependencies(migrations)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sorted, err := topoSort(migrations, deps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := versionsOf(sorted); !slices.Equal(got, tt.want) {
+				t.Errorf("topoSort() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopoSortCycle(t *testing.T) {
+	migrations := testMigrations("001", "002:003", "003:002", "004:001")
+	deps, err := dependencies(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = topoSort(migrations, deps)
+	if err == nil {
+		t.Fatal("topoSort() accepted a cycle")
+	}
+	// 004 depends only on 001, so it is not reported as part of the cycle
+	if !strings.Contains(err.Error(), "cycle between 002, 003") {
+		t.Errorf("topoSort() error = %v, want the cycle between 002 and 003", err)
+	}
+}
+
+// recordingApply applies migrations by recording their order, failing the versions in fail
+type recordingApply struct {
+	mu      sync.Mutex
+	order   []string
+	fail    map[string]bool
+	running int
+	peak    int
+}
+
+func (r *recordingApply) apply(mig *migration) error {
+	r.mu.Lock()
+	r.running++
+	r.peak = max(r.peak, r.running)
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		r.running--
+		r.order = append(r.order, mig.Version)
+		r.mu.Unlock()
+	}()
+
+	if r.fail[mig.Version] {
+		return errors.New("failed " + mig.Version)
+	}
+	return nil
+}
+
+func TestApplyConcurrentlyOrder(t *testing.T) {
+	migrations := testMigrations("001", "002:001", "003:001", "004:002,003", "005")
+	deps, err := dependencies(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &recordingApply{}
+	m := &Migrator{Workers: 2}
+	if err := m.applyConcurrently(migrations, deps, map[string]bool{}, rec.apply); err != nil {
+		t.Fatal(err)
+	}
+
+	position := make(map[string]int)
+	for i, version := range rec.order {
+		position[version] = i
+	}
+	if len(position) != len(migrations) {
+		t.Fatalf("applied %v, want every migration once", rec.order)
+	}
+	for version, versionDeps := range deps {
+		for _, dep := range versionDeps {
+			if position[dep] > position[version] {
+				t.Errorf("%s was applied before its dependency %s: %v", version, dep, rec.order)
+			}
+		}
+	}
+	if rec.peak > m.Workers {
+		t.Errorf("%d migrations ran at once, want at most %d", rec.peak, m.Workers)
+	}
+}
+
+func TestApplyConcurrentlyStopsAfterFailure(t *testing.T) {
+	migrations := testMigrations("001", "002:001", "003:002", "004:001")
+	deps, err := dependencies(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &recordingApply{fail: map[string]bool{"002": true}}
+	m := &Migrator{Workers: 1}
+	err = m.applyConcurrently(migrations, deps, map[string]bool{}, rec.apply)
+	if err == nil || err.Error() != "failed 002" {
+		t.Fatalf("applyConcurrently() error = %v, want failed 002", err)
+	}
+
+	// 004 was ready together with 002 but is not started once 002 failed, 003 depends on 002
+	if !slices.Equal(rec.order, []string{"001", "002"}) {
+		t.Errorf("applied %v, want [001 002]", rec.order)
+	}
+}
+
+func TestApplyConcurrentlySkippedDependency(t *testing.T) {
+	migrations := testMigrations("001", "002", "003", "004")
+	deps, err := dependencies(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 001 is applied and 002 is skipped by a filter, so 003 still waits for nothing and 004 for 003
+	pending := []*migration{migrations[2], migrations[3]}
+	rec := &recordingApply{}
+	m := &Migrator{Workers: 4}
+	if err := m.applyConcurrently(pending, deps, map[string]bool{"001": true}, rec.apply); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(rec.order, []string{"003", "004"}) {
+		t.Errorf("applied %v, want [003 004]", rec.order)
+	}
+	if rec.peak != 1 {
+		t.Errorf("%d migrations ran at once, want 004 to wait for 003", rec.peak)
+	}
+}
+
+func TestApplyConcurrentlyWaitsThroughSkippedMigration(t *testing.T) {
+	migrations := testMigrations("001", "002", "003")
+	deps, err := dependencies(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 002 is skipped by a filter, 003 still has to wait for 001 through it
+	pending := []*migration{migrations[0], migrations[2]}
+	rec := &recordingApply{}
+	m := &Migrator{Workers: 4}
+	if err := m.applyConcurrently(pending, deps, map[string]bool{}, rec.apply); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(rec.order, []string{"001", "003"}) || rec.peak != 1 {
+		t.Errorf("applied %v with %d at once, want [001 003] one at a time", rec.order, rec.peak)
+	}
+}
@@ -0,0 +1,305 @@
+package migrator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// dataMarker names data migrations, directories such as 020_data_countries holding documents to load
+const dataMarker = "data"
+
+// DataMode selects how the documents of data migrations are written
+type DataMode string
+
+const (
+	// DataUpsert sets the fields of existing documents and inserts missing ones
+	DataUpsert DataMode = "upsert"
+	// DataInsert inserts the documents and fails on existing ones
+	DataInsert DataMode = "insert"
+	// DataReplace replaces existing documents as a whole and inserts missing ones
+	DataReplace DataMode = "replace"
+)
+
+// parseDataDirName returns the version of a data migration directory such as 020_data_countries or 020_data@staging
+func parseDataDirName(dirName string) (version string, ok bool) {
+	name, _, _ := strings.Cut(dirName, "@")
+	parts := strings.SplitN(name, "_", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] != dataMarker {
+		return "", false
+	}
+	return parts[0], true
+}
+
+// isDataFile reports whether a filename names a data file, whose collection is the name without its extension
+func isDataFile(fileName string) bool {
+	if strings.HasPrefix(fileName, "_") {
+		return false
+	}
+	switch filepath.Ext(fileName) {
+	case ".json", ".ndjson", ".bson":
+		return true
+	}
+	return false
+}
+
+// dataFiles returns the data files of a data migration directory ordered by name
+func dataFiles(dir string) ([]string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data directory %s: %w", dir, err)
+	}
+
+	var paths []string
+	for _, file := range files {
+		if !file.IsDir() && isDataFile(file.Name()) {
+			paths = append(paths, filepath.Join(dir, file.Name()))
+		}
+	}
+
+	return paths, nil
+}
+
+// dataStep parses the documents of a data migration directory and returns the function loading them,
+// or deleting them by _id when rolling back. The function reports the written documents per collection.
+func (m *Migrator) dataStep(dir, direction string) (stepFunc, error) {
+	paths, err := dataFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type dataFile struct {
+		path      string
+		documents []bson.D
+	}
+	files := make([]dataFile, 0, len(paths))
+	for _, path := range paths {
+		documents, err := readDataFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, dataFile{path: path, documents: documents})
+	}
+
+	return func() (outcome, error) {
+		var summary strings.Builder
+		for _, file := range files {
+			collectionName := strings.TrimSuffix(filepath.Base(file.path), filepath.Ext(file.path))
+
+			var n int64
+			var err error
+			if direction == "down" {
+				n, err = m.unloadDocuments(collectionName, file.documents)
+			} else {
+				n, err = m.loadDocuments(collectionName, file.documents)
+			}
+			if err != nil {
+				return outcome{}, &MigrationError{Script: file.path, Err: err}
+			}
+
+			fmt.Fprintf(&summary, "%s: %d documents\n", collectionName, n)
+		}
+
+		return outcome{Output: summary.String()}, nil
+	}, nil
+}
+
+// loadDocuments writes documents to a collection in DataMode and returns how many were written
+func (m *Migrator) loadDocuments(collectionName string, documents []bson.D) (int64, error) {
+	if len(documents) == 0 {
+		return 0, nil
+	}
+
+	mode := m.DataMode
+	if mode == "" {
+		mode = DataUpsert
+	}
+
+	models := make([]mongo.WriteModel, 0, len(documents))
+	for i, doc := range documents {
+		id, ok := documentID(doc)
+		if !ok {
+			return 0, fmt.Errorf("document %d of %s has no _id", i, collectionName)
+		}
+
+		switch mode {
+		case DataInsert:
+			models = append(models, mongo.NewInsertOneModel().SetDocument(doc))
+		case DataReplace:
+			models = append(models, mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": id}).SetReplacement(doc).SetUpsert(true))
+		case DataUpsert:
+			fields := make(bson.D, 0, len(doc))
+			for _, field := range doc {
+				if field.Key != "_id" {
+					fields = append(fields, field)
+				}
+			}
+			models = append(models, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": id}).SetUpdate(bson.M{"$set": fields}).SetUpsert(true))
+		default:
+			return 0, fmt.Errorf("unknown data mode %q", mode)
+		}
+	}
+
+	collection := m.dbClient.Database(m.DBName).Collection(collectionName)
+	result, err := collection.BulkWrite(context.Background(), models, options.BulkWrite().SetOrdered(true))
+	if err != nil {
+		return 0, fmt.Errorf("failed to load documents into %s: %w", collectionName, err)
+	}
+
+	return result.InsertedCount + result.UpsertedCount + result.ModifiedCount, nil
+}
+
+// unloadDocuments deletes the documents of a data file from a collection by their _id
+func (m *Migrator) unloadDocuments(collectionName string, documents []bson.D) (int64, error) {
+	ids := make(bson.A, 0, len(documents))
+	for i, doc := range documents {
+		id, ok := documentID(doc)
+		if !ok {
+			return 0, fmt.Errorf("document %d of %s has no _id", i, collectionName)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	collection := m.dbClient.Database(m.DBName).Collection(collectionName)
+	result, err := collection.DeleteMany(context.Background(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove documents from %s: %w", collectionName, err)
+	}
+
+	return result.DeletedCount, nil
+}
+
+// documentID returns the _id of a document
+func documentID(doc bson.D) (any, bool) {
+	for _, field := range doc {
+		if field.Key == "_id" {
+			return field.Value, true
+		}
+	}
+	return nil, false
+}
+
+// readDataFile parses a .json file holding an EJSON document or array of documents,
+// a .ndjson file holding one EJSON document per line, or a .bson file as written by mongodump
+func readDataFile(path string) ([]bson.D, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data file %s: %w", path, err)
+	}
+
+	switch filepath.Ext(path) {
+	case ".ndjson":
+		return parseNDJSON(path, content)
+	case ".bson":
+		return parseBSON(path, content)
+	}
+	return parseJSON(path, content)
+}
+
+// parseJSON parses an EJSON document or array of EJSON documents
+func parseJSON(path string, content []byte) ([]bson.D, error) {
+	trimmed := bytes.TrimSpace(content)
+	if !bytes.HasPrefix(trimmed, []byte("[")) {
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON(trimmed, false, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		return []bson.D{doc}, nil
+	}
+
+	// Extended JSON has no top level arrays, so the array is wrapped into a document
+	var wrapper struct {
+		Documents []bson.D `bson:"documents"`
+	}
+	wrapped := append(append([]byte(`{"documents":`), trimmed...), '}')
+	if err := bson.UnmarshalExtJSON(wrapped, false, &wrapper); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return wrapper.Documents, nil
+}
+
+// parseNDJSON parses one EJSON document per line, skipping empty lines
+func parseNDJSON(path string, content []byte) ([]bson.D, error) {
+	var documents []bson.D
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON(text, false, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse %s line %d: %w", path, line, err)
+		}
+		documents = append(documents, doc)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return documents, nil
+}
+
+// parseBSON parses concatenated BSON documents
+func parseBSON(path string, content []byte) ([]bson.D, error) {
+	var documents []bson.D
+
+	reader := bytes.NewReader(content)
+	for {
+		raw, err := bson.NewFromIOReader(reader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		var doc bson.D
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		documents = append(documents, doc)
+	}
+
+	return documents, nil
+}
+
+// dirChecksum returns the hex encoded SHA-256 checksum of the names and contents of the data files of a directory
+func dirChecksum(dir string) (string, error) {
+	paths, err := dataFiles(dir)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read data file %s: %w", path, err)
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00", filepath.Base(path), len(content))
+		hash.Write(content)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,148 @@
+package migrator
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// documentIDs returns the _id of every document, or nil for documents without one
+func documentIDs(documents []bson.D) []any {
+	ids := make([]any, 0, len(documents))
+	for _, doc := range documents {
+		id, _ := documentID(doc)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		ids     []any
+		wantErr bool
+	}{
+		{"single document", `{"_id": "de", "name": "Germany"}`, []any{"de"}, false},
+		{"array", `[{"_id": "de"}, {"_id": "fr"}]`, []any{"de", "fr"}, false},
+		{"array with leading whitespace", "\n  [{\"_id\": 1}]\n", []any{int32(1)}, false},
+		{"empty array", `[]`, []any{}, false},
+		{"extended json", `{"_id": {"$oid": "5f1d7a3e9b1e8b3a1c9e4d21"}, "at": {"$date": "2024-01-01T00:00:00Z"}}`, nil, false},
+		{"invalid document", `{"_id": }`, nil, true},
+		{"array of scalars", `[1, 2]`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			documents, err := parseJSON("test.json", []byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJSON() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil || tt.ids == nil {
+				return
+			}
+			if got := documentIDs(documents); !slices.Equal(got, tt.ids) {
+				t.Errorf("parseJSON() ids = %v, want %v", got, tt.ids)
+			}
+		})
+	}
+}
+
+func TestParseNDJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		ids     []any
+		wantErr bool
+	}{
+		{"one document per line", "{\"_id\": 1}\n{\"_id\": 2}\n", []any{int32(1), int32(2)}, false},
+		{"blank lines", "\n{\"_id\": 1}\n\n   \n{\"_id\": 2}", []any{int32(1), int32(2)}, false},
+		{"windows line endings", "{\"_id\": 1}\r\n{\"_id\": 2}\r\n", []any{int32(1), int32(2)}, false},
+		{"empty file", "", []any{}, false},
+		{"invalid line", "{\"_id\": 1}\n{\"_id\": \n", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			documents, err := parseNDJSON("test.ndjson", []byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseNDJSON() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && !slices.Equal(documentIDs(documents), tt.ids) {
+				t.Errorf("parseNDJSON() ids = %v, want %v", documentIDs(documents), tt.ids)
+			}
+		})
+	}
+}
+
+func TestParseBSON(t *testing.T) {
+	var content []byte
+	for _, id := range []string{"de", "fr"} {
+		raw, err := bson.Marshal(bson.D{{Key: "_id", Value: id}, {Key: "name", Value: id}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		content = append(content, raw...)
+	}
+
+	documents, err := parseBSON("test.bson", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := documentIDs(documents); !slices.Equal(got, []any{"de", "fr"}) {
+		t.Errorf("parseBSON() ids = %v, want [de fr]", got)
+	}
+
+	if documents, err := parseBSON("empty.bson", nil); err != nil || len(documents) != 0 {
+		t.Errorf("parseBSON(empty) = %v, %v, want no documents", documents, err)
+	}
+	if _, err := parseBSON("truncated.bson", content[:len(content)-3]); err == nil {
+		t.Error("parseBSON() accepted a truncated document")
+	}
+}
+
+func TestReadDataFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"countries.json":   `[{"_id": "de"}, {"_id": "fr"}]`,
+		"countries.ndjson": "{\"_id\": \"de\"}\n{\"_id\": \"fr\"}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		documents, err := readDataFile(path)
+		if err != nil {
+			t.Fatalf("readDataFile(%s) error = %v", name, err)
+		}
+		if got := documentIDs(documents); !slices.Equal(got, []any{"de", "fr"}) {
+			t.Errorf("readDataFile(%s) ids = %v, want [de fr]", name, got)
+		}
+	}
+
+	if _, err := readDataFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("readDataFile() accepted a missing file")
+	}
+}
+
+func TestIsDataFile(t *testing.T) {
+	tests := map[string]bool{
+		"countries.json":   true,
+		"countries.ndjson": true,
+		"countries.bson":   true,
+		"_notes.json":      false,
+		"countries.csv":    false,
+		"README.md":        false,
+	}
+
+	for fileName, want := range tests {
+		if got := isDataFile(fileName); got != want {
+			t.Errorf("isDataFile(%q) = %v, want %v", fileName, got, want)
+		}
+	}
+}
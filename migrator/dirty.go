@@ -0,0 +1,121 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// setDirty flags a migration record as in progress before its script runs in the given direction, creating the record when needed
+func (m *Migrator) setDirty(version, direction string) error {
+	collection := m.dbClient.Database(m.DBName).Collection("migrations")
+
+	_, err := collection.UpdateOne(context.Background(),
+		m.scope(bson.M{"version": version}),
+		bson.M{
+			"$set":         bson.M{"dirty": true, "dirtyDirection": direction},
+			"$setOnInsert": bson.M{"appliedAt": time.Now()},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark migration %s as dirty: %w", version, err)
+	}
+
+	return nil
+}
+
+// recordFailure stores the exit code and error output of a failed migration script on its dirty record
+func (m *Migrator) recordFailure(version string, err error) {
+	var migErr *MigrationError
+	if !errors.As(err, &migErr) {
+		return
+	}
+
+	collection := m.dbClient.Database(m.DBName).Collection("migrations")
+	_, err = collection.UpdateOne(context.Background(),
+		m.scope(bson.M{"version": version, "dirty": true}),
+		bson.M{"$set": bson.M{"exitCode": migErr.ExitCode, "output": migErr.Stderr}},
+	)
+	if err != nil {
+		m.logger().Error("failed to record migration failure", "version", version, "error", err)
+	}
+}
+
+// dirtyVersion returns the version of the migration a previous run failed on, or an empty string
+func (m *Migrator) dirtyVersion() (string, error) {
+	collection := m.dbClient.Database(m.DBName).Collection("migrations")
+
+	var record MigrationRecord
+	err := collection.FindOne(context.Background(), m.scope(bson.M{"dirty": true})).Decode(&record)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to check dirty state: %w", err)
+	}
+
+	return record.Version, nil
+}
+
+// checkDirty returns ErrDirty when a previous run failed halfway through a migration
+func (m *Migrator) checkDirty() error {
+	version, err := m.dirtyVersion()
+	if err != nil {
+		return err
+	}
+	if version != "" {
+		return fmt.Errorf("%w: migration %s did not finish, fix the database and call ClearDirty or DiscardDirty", ErrDirty, version)
+	}
+	return nil
+}
+
+// ClearDirty marks a migration that failed halfway as applied once the database has been fixed by hand
+func (m *Migrator) ClearDirty(version string) error {
+	collection := m.dbClient.Database(m.DBName).Collection("migrations")
+
+	result, err := collection.UpdateOne(context.Background(),
+		m.scope(bson.M{"version": version, "dirty": true}),
+		bson.M{"$unset": bson.M{"dirty": "", "dirtyDirection": ""}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to clear dirty state: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("migration %s is not dirty", version)
+	}
+
+	return nil
+}
+
+// DiscardDirty restores the state before a migration failed halfway, e.g. when its transaction was aborted,
+// so the migration is retried by the next run. A failed up is no longer recorded, a failed down stays applied.
+func (m *Migrator) DiscardDirty(version string) error {
+	collection := m.dbClient.Database(m.DBName).Collection("migrations")
+	filter := m.scope(bson.M{"version": version, "dirty": true})
+
+	var record MigrationRecord
+	if err := collection.FindOne(context.Background(), filter).Decode(&record); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("migration %s is not dirty", version)
+		}
+		return fmt.Errorf("failed to fetch dirty migration: %w", err)
+	}
+
+	var err error
+	if record.DirtyDirection == "down" {
+		_, err = collection.UpdateOne(context.Background(), filter, bson.M{"$unset": bson.M{"dirty": "", "dirtyDirection": "", "exitCode": ""}})
+	} else {
+		_, err = collection.DeleteOne(context.Background(), filter)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to discard dirty state: %w", err)
+	}
+
+	return nil
+}
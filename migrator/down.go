@@ -2,42 +2,184 @@ package migrator
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
+	"sort"
 )
 
-// Down applies all down migrations in the scripts directory that have been applied
+// Down rolls back all applied migrations, newest first.
+// With ReportNoChange set, it returns ErrNoChange when there was nothing to roll back.
 func (m *Migrator) Down() error {
-	files, err := os.ReadDir(m.ScriptDir)
-	if err != nil {
-		return fmt.Errorf("failed to read script directory: %w", err)
+	return m.DownTo("")
+}
+
+// DownTo rolls back applied migrations newer than the given version, newest first.
+// It refuses to cross a migration that is irreversible or has no down script unless ForceRollback is set,
+// in which case the record of such a migration is removed without running anything.
+func (m *Migrator) DownTo(version string) error {
+	return m.run("down", func() error {
+		return m.downTo(version)
+	})
+}
+
+func (m *Migrator) downTo(version string) error {
+	if err := m.checkDirty(); err != nil {
+		return err
 	}
 
-	appliedMigrations, err := m.appliedMigrations()
+	plan, err := m.downPlan(version)
 	if err != nil {
 		return err
 	}
 
-	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".js") && strings.Contains(file.Name(), "down") {
-			version := extractVersionFromFileName(file.Name())
-			if !appliedMigrations[version] {
-				fmt.Printf("Migration %s not applied, skipping.\n", version)
-				continue
+	// Checks such as @requires-server or placeholders fail before any migration is rolled back or marked dirty
+	versions := make([]string, 0, len(plan))
+	for _, step := range plan {
+		if step.mig != nil && step.mig.DownPath != "" && !step.mig.Header.NoDown {
+			if err := m.check(step.mig, "down"); err != nil {
+				return err
+			}
+		}
+		versions = append(versions, step.version)
+	}
+	m.emit(Event{Type: PlanComputed, Direction: "down", Plan: versions})
+
+	if len(plan) == 0 {
+		return ErrNoChange
+	}
+
+	for _, step := range plan {
+		if step.mig == nil || step.mig.DownPath == "" || step.mig.Header.NoDown {
+			m.logger().Warn("migration cannot be rolled back, removing its record only", "version", step.version, "direction", "down")
+			if err := m.removeMigrationRecord(step.version); err != nil {
+				return err
 			}
+			continue
+		}
 
-			scriptPath := filepath.Join(m.ScriptDir, file.Name())
-			if err := m.runScript(scriptPath); err != nil {
+		err := m.step("down", step.version, step.mig.DownPath, func() error {
+			if _, err := m.execute(step.mig, "down"); err != nil {
 				return err
 			}
 
-			// Remove the migration record after a successful rollback
-			if err := m.removeMigrationRecord(version); err != nil {
+			// Remove the migration record, and with it the dirty flag, after a successful rollback
+			if err := m.removeMigrationRecord(step.version); err != nil {
 				return err
 			}
+
+			// A squashed rollback also undoes the migrations it consolidated
+			if from, to, ok := squashedRange(step.mig.DownPath); ok {
+				return m.removeMigrationRange(from, to)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
+
+// downStep is a single rollback in a down plan; mig is nil when the version has no scripts on disk
+type downStep struct {
+	version string
+	mig     *migration
+}
+
+// downPlan lists the applied migrations newer than the target version in reverse dependency order,
+// and verifies that each of them can be rolled back without leaving a dependent migration applied
+func (m *Migrator) downPlan(target string) ([]downStep, error) {
+	migrations, _, err := m.plannedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	appliedMigrations, err := m.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[string]*migration, len(migrations))
+	rank := make(map[string]int, len(migrations))
+	for i, mig := range migrations {
+		byVersion[mig.Version] = mig
+		rank[mig.Version] = i
+	}
+
+	// Versions are compared as strings, so a target that is not a known version would select the wrong migrations
+	if target != "" && byVersion[target] == nil && !appliedMigrations[target] && squashCovering(migrations, target) == nil {
+		return nil, fmt.Errorf("unknown target version %s", target)
+	}
+
+	var versions []string
+	for version := range appliedMigrations {
+		if version > target {
+			versions = append(versions, version)
+		}
+	}
+	// Dependents are rolled back before their dependencies, versions without scripts go last
+	sort.Slice(versions, func(i, j int) bool {
+		ri, iok := rank[versions[i]]
+		rj, jok := rank[versions[j]]
+		if iok != jok {
+			return iok
+		}
+		if iok && ri != rj {
+			return ri > rj
+		}
+		return versions[i] > versions[j]
+	})
+
+	var plan []downStep
+	for _, version := range versions {
+		mig := byVersion[version]
+		if mig == nil {
+			// Versions consolidated into a squashed migration are removed together with it
+			if squash := squashCovering(migrations, version); squash != nil {
+				if from, _, _ := squashedRange(squash.UpPath); from <= target {
+					return nil, fmt.Errorf("cannot roll back to %s, it lies inside squashed migrations %s-%s", target, from, squash.Version)
+				}
+				continue
+			}
+		} else if !m.selected(mig.Header) {
+			continue
+		} else if from, _, ok := squashedRange(mig.UpPath); ok && from <= target {
+			return nil, fmt.Errorf("cannot roll back to %s, it lies inside squashed migrations %s-%s", target, from, mig.Version)
+		}
+
+		if mig == nil || mig.DownPath == "" || mig.Header.NoDown {
+			if !m.ForceRollback {
+				return nil, fmt.Errorf("%w: cannot roll back %s, set ForceRollback to roll back past it", ErrIrreversible, version)
+			}
+		}
+
+		plan = append(plan, downStep{version: version, mig: mig})
+	}
+
+	rolledBack := make(map[string]bool, len(plan))
+	for _, step := range plan {
+		rolledBack[step.version] = true
+	}
+	for version := range appliedMigrations {
+		mig := byVersion[version]
+		if rolledBack[version] || mig == nil {
+			continue
+		}
+		for _, dep := range mig.Header.DependsOn {
+			if rolledBack[dep] {
+				return nil, fmt.Errorf("cannot roll back %s, migration %s depends on it and stays applied", dep, version)
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// squashCovering returns the squashed migration whose range contains the given version
+func squashCovering(migrations []*migration, version string) *migration {
+	for _, mig := range migrations {
+		if from, to, ok := squashedRange(mig.UpPath); ok && version >= from && version <= to {
+			return mig
+		}
+	}
+	return nil
+}
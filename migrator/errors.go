@@ -0,0 +1,66 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNoChange is returned when a run found nothing to apply or roll back and ReportNoChange is set
+	ErrNoChange = errors.New("no change")
+	// ErrDirty is returned when a previous run failed halfway through a migration
+	ErrDirty = errors.New("database is dirty")
+	// ErrLocked is returned when another process holds the migration lock
+	ErrLocked = errors.New("migrations are locked by another process")
+	// ErrChecksumMismatch is returned when applied migrations changed on disk
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrNotReady is returned by RequireVersion when the database is behind the expected version
+	ErrNotReady = errors.New("schema is not ready")
+	// ErrIrreversible is returned when a rollback would cross a migration that cannot be rolled back
+	ErrIrreversible = errors.New("migration is irreversible")
+)
+
+// noChange hides ErrNoChange from callers that did not ask for it with ReportNoChange
+func (m *Migrator) noChange(err error) error {
+	if errors.Is(err, ErrNoChange) && !m.ReportNoChange {
+		return nil
+	}
+	return err
+}
+
+// MigrationError describes a script that failed to run
+type MigrationError struct {
+	Version   string
+	Direction string
+	Script    string
+	// ExitCode is the exit code of mongosh, or -1 when it did not exit on its own. It is 0 for migrations run through the driver.
+	ExitCode int
+	// Stderr holds the tail of the error output of mongosh
+	Stderr string
+	Err    error
+}
+
+func (e *MigrationError) Error() string {
+	msg := fmt.Sprintf("failed to run script %s", e.Script)
+	if e.Version != "" {
+		msg = fmt.Sprintf("migration %s %s: %s", e.Version, e.Direction, msg)
+	}
+	if e.ExitCode > 0 {
+		msg += fmt.Sprintf(" (exit code %d)", e.ExitCode)
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// withMigration fills in the version and direction of a MigrationError returned for a migration script
+func withMigration(err error, version, direction string) error {
+	var migErr *MigrationError
+	if errors.As(err, &migErr) {
+		migErr.Version = version
+		migErr.Direction = direction
+	}
+	return err
+}
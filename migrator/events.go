@@ -0,0 +1,67 @@
+package migrator
+
+import (
+	"time"
+)
+
+// EventType identifies what happened during a run
+type EventType string
+
+const (
+	// PlanComputed is emitted once the migrations a run will apply or roll back are known
+	PlanComputed EventType = "PlanComputed"
+	// LockAcquired is emitted when the migration lock was acquired, Duration is the time spent waiting for it
+	LockAcquired EventType = "LockAcquired"
+	// MigrationStarted is emitted before a migration script runs
+	MigrationStarted EventType = "MigrationStarted"
+	// MigrationSucceeded is emitted after a migration script succeeded
+	MigrationSucceeded EventType = "MigrationSucceeded"
+	// MigrationFailed is emitted after a migration script failed
+	MigrationFailed EventType = "MigrationFailed"
+	// RunFinished is emitted at the end of every run, Err is nil or ErrNoChange when it succeeded
+	RunFinished EventType = "RunFinished"
+)
+
+// Event describes a step of a run
+type Event struct {
+	Type      EventType
+	Direction string
+	// Version is the migration version, or the name of a repeatable script
+	Version string
+	// Plan lists the versions of a PlanComputed event in the order they will run
+	Plan     []string
+	Duration time.Duration
+	Err      error
+}
+
+// Subscribe registers a function that is called synchronously for every event.
+// Subscribers must be registered before a run starts.
+func (m *Migrator) Subscribe(fn func(Event)) {
+	m.subscribers = append(m.subscribers, fn)
+}
+
+// emit sends an event to all subscribers
+func (m *Migrator) emit(event Event) {
+	for _, fn := range m.subscribers {
+		fn(event)
+	}
+}
+
+// step runs a single migration script wrapped by the each callbacks, logging it and emitting its events
+func (m *Migrator) step(direction, version, script string, fn func() error) error {
+	m.emit(Event{Type: MigrationStarted, Direction: direction, Version: version})
+
+	start := time.Now()
+	err := m.withEachCallbacks(version, fn)
+	duration := time.Since(start)
+
+	if err != nil {
+		m.logger().Error("migration failed", "version", version, "direction", direction, "script", script, "duration", duration, "error", err)
+		m.emit(Event{Type: MigrationFailed, Direction: direction, Version: version, Duration: duration, Err: err})
+		return err
+	}
+
+	m.logger().Info("migration finished", "version", version, "direction", direction, "script", script, "duration", duration)
+	m.emit(Event{Type: MigrationSucceeded, Direction: direction, Version: version, Duration: duration})
+	return nil
+}
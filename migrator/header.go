@@ -0,0 +1,175 @@
+package migrator
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// header holds the directives declared in the leading comment block of a migration script, e.g.
+//
+//	// @description add email to users
+//	// @timeout 10m
+//	// @transaction
+//	// @requires-server >=6.0
+//	// @tags reporting,backfill
+//	// @no-down
+//	// @depends-on 003,007
+//	// @env staging,dev
+//
+// Tags can also be given as @ separated segments at the end of the filename, e.g. 010_up_seed_tenants@staging@demo.js.
+type header struct {
+	Description    string
+	Timeout        time.Duration
+	Transaction    bool
+	RequiresServer string
+	Tags           []string
+	NoDown         bool
+	DependsOn      []string
+	Environments   []string
+}
+
+// errUnknownDirective is returned by header.apply for directives it does not know
+var errUnknownDirective = errors.New("unknown directive")
+
+// parseHeader reads the directives of a script. Unknown directives are rejected in strict mode and logged otherwise.
+// Pipeline migrations cannot hold comments, they declare their directives as fields of their EJSON document.
+func (m *Migrator) parseHeader(scriptPath string) (header, error) {
+	if filepath.Ext(scriptPath) == ".json" {
+		return pipelineHeader(scriptPath)
+	}
+
+	var hdr header
+
+	file, err := os.Open(scriptPath)
+	if err != nil {
+		return hdr, fmt.Errorf("failed to open script %s: %w", scriptPath, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		// The header ends with the first line that is not a comment
+		comment, ok := headerComment(line)
+		if !ok {
+			break
+		}
+
+		if !strings.HasPrefix(comment, "@") {
+			continue
+		}
+
+		name, value, _ := strings.Cut(comment[1:], " ")
+		value = strings.TrimSpace(value)
+		if err := hdr.apply(name, value); err != nil {
+			if errors.Is(err, errUnknownDirective) && !m.StrictDirectives {
+				m.logger().Warn("ignoring unknown directive", "script", scriptPath, "directive", name)
+				continue
+			}
+			return hdr, fmt.Errorf("invalid directive in %s: %w", scriptPath, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return hdr, fmt.Errorf("failed to read script %s: %w", scriptPath, err)
+	}
+
+	hdr.Tags = append(hdr.Tags, fileTags(scriptPath)...)
+
+	return hdr, nil
+}
+
+// headerComment returns the text of a // comment line, or of a # comment line of a shell script
+func headerComment(line string) (string, bool) {
+	for _, prefix := range []string{"//", "#"} {
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimSpace(strings.TrimPrefix(line, prefix)), true
+		}
+	}
+	return "", false
+}
+
+// apply sets a single directive on the header
+func (h *header) apply(name, value string) error {
+	switch name {
+	case "description":
+		h.Description = value
+	case "timeout":
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("@timeout must be a positive duration, got %q", value)
+		}
+		h.Timeout = timeout
+	case "transaction":
+		h.Transaction = true
+	case "requires-server":
+		if _, _, err := parseVersionConstraint(value); err != nil {
+			return err
+		}
+		h.RequiresServer = value
+	case "tags":
+		h.Tags = splitList(value)
+	case "no-down":
+		h.NoDown = true
+	case "env":
+		h.Environments = splitList(value)
+		if len(h.Environments) == 0 {
+			return fmt.Errorf("@env needs at least one environment")
+		}
+	case "depends-on":
+		h.DependsOn = splitList(value)
+		if len(h.DependsOn) == 0 {
+			return fmt.Errorf("@depends-on needs at least one version")
+		}
+	default:
+		return fmt.Errorf("%w @%s", errUnknownDirective, name)
+	}
+
+	return nil
+}
+
+// fileTags returns the @ separated tags at the end of a script filename, e.g. staging for 010_up_seed@staging.js
+func fileTags(scriptPath string) []string {
+	return nameTags(strings.TrimSuffix(filepath.Base(scriptPath), filepath.Ext(scriptPath)))
+}
+
+// nameTags returns the @ separated tags at the end of a script or directory name without extension.
+// Unlike dots, which may be part of a description such as upgrade_to_v1.2, @ only marks tags.
+func nameTags(name string) []string {
+	_, tags, ok := strings.Cut(name, "@")
+	if !ok {
+		return nil
+	}
+	return splitList(strings.ReplaceAll(tags, "@", ","))
+}
+
+// hasAnyTag reports whether the header carries at least one of the given tags
+func (h header) hasAnyTag(tags []string) bool {
+	for _, want := range tags {
+		for _, tag := range h.Tags {
+			if tag == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitList splits a comma separated directive value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
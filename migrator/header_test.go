@@ -0,0 +1,209 @@
+package migrator
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeScript writes a migration script into a temporary directory and returns its path
+func writeScript(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseHeader(t *testing.T) {
+	path := writeScript(t, "001_up_add_email.js", `// @description add email to users
+// @timeout 10m
+
+// a plain comment
+//@transaction
+// @requires-server >=6.0
+// @tags reporting, backfill
+// @no-down
+// @depends-on 000
+// @env staging,dev
+db.users.updateMany({}, { $set: { email: "" } });
+// @tags ignored after the first statement
+`)
+
+	hdr, err := (&Migrator{}).parseHeader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := header{
+		Description:    "add email to users",
+		Timeout:        10 * time.Minute,
+		Transaction:    true,
+		RequiresServer: ">=6.0",
+		Tags:           []string{"reporting", "backfill"},
+		NoDown:         true,
+		DependsOn:      []string{"000"},
+		Environments:   []string{"staging", "dev"},
+	}
+	if !reflect.DeepEqual(hdr, want) {
+		t.Errorf("parseHeader() = %+v, want %+v", hdr, want)
+	}
+}
+
+func TestParseHeaderShellComments(t *testing.T) {
+	path := writeScript(t, "040_up_clean_addresses.sh", "#!/bin/sh\n# @timeout 1m\n# @tags cleanup\nmongosh \"$MONGODB_URI\" --eval 'db.addresses.drop()'\n")
+
+	hdr, err := (&Migrator{}).parseHeader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Timeout != time.Minute || !slices.Equal(hdr.Tags, []string{"cleanup"}) {
+		t.Errorf("parseHeader() = %+v, want a 1m timeout and the cleanup tag", hdr)
+	}
+}
+
+func TestParseHeaderUnknownDirective(t *testing.T) {
+	path := writeScript(t, "001_up_add_email.js", "// @descripton typo\n// @timeout 1m\ndb.users.find();\n")
+
+	lenient := &Migrator{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	hdr, err := lenient.parseHeader(path)
+	if err != nil {
+		t.Fatalf("parseHeader() error = %v, want the unknown directive ignored", err)
+	}
+	if hdr.Timeout != time.Minute {
+		t.Errorf("parseHeader() timeout = %s, want the directives after the unknown one applied", hdr.Timeout)
+	}
+
+	strict := &Migrator{StrictDirectives: true}
+	if _, err := strict.parseHeader(path); !errors.Is(err, errUnknownDirective) {
+		t.Errorf("parseHeader() in strict mode error = %v, want errUnknownDirective", err)
+	}
+}
+
+func TestParseHeaderInvalidDirective(t *testing.T) {
+	// Invalid values are rejected whether or not the migrator is strict
+	path := writeScript(t, "001_up_add_email.js", "// @timeout soon\ndb.users.find();\n")
+	if _, err := (&Migrator{}).parseHeader(path); err == nil || !strings.Contains(err.Error(), "invalid directive") {
+		t.Errorf("parseHeader() error = %v, want an invalid directive", err)
+	}
+}
+
+func TestHeaderApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"description", "add email", false},
+		{"description", "", false},
+		{"timeout", "90s", false},
+		{"timeout", "0s", true},
+		{"timeout", "-1m", true},
+		{"timeout", "soon", true},
+		{"transaction", "", false},
+		{"requires-server", ">=6.0", false},
+		{"requires-server", ">=", true},
+		{"tags", "a,b", false},
+		{"no-down", "", false},
+		{"env", "staging", false},
+		{"env", " , ", true},
+		{"depends-on", "001,002", false},
+		{"depends-on", "", true},
+		{"retries", "3", true},
+	}
+
+	for _, tt := range tests {
+		var hdr header
+		if err := hdr.apply(tt.name, tt.value); (err != nil) != tt.wantErr {
+			t.Errorf("apply(%q, %q) error = %v, want error %v", tt.name, tt.value, err, tt.wantErr)
+		}
+	}
+
+	var hdr header
+	if err := hdr.apply("retries", "3"); !errors.Is(err, errUnknownDirective) {
+		t.Errorf("apply() of an unknown directive error = %v, want errUnknownDirective", err)
+	}
+}
+
+func TestHeaderComment(t *testing.T) {
+	tests := []struct {
+		line    string
+		comment string
+		ok      bool
+	}{
+		{"// @timeout 1m", "@timeout 1m", true},
+		{"//@no-down", "@no-down", true},
+		{"# @tags cleanup", "@tags cleanup", true},
+		{"#!/bin/sh", "!/bin/sh", true},
+		{"db.users.find();", "", false},
+		{"/* @timeout 1m */", "", false},
+	}
+
+	for _, tt := range tests {
+		comment, ok := headerComment(tt.line)
+		if comment != tt.comment || ok != tt.ok {
+			t.Errorf("headerComment(%q) = %q, %v, want %q, %v", tt.line, comment, ok, tt.comment, tt.ok)
+		}
+	}
+}
+
+func TestNameTags(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"010_up_seed_tenants@staging@demo", []string{"staging", "demo"}},
+		{"010_up@staging", []string{"staging"}},
+		{"020_data_countries@staging", []string{"staging"}},
+		// Dots belong to the description, they never mark tags
+		{"030_up_upgrade_to_v1.2", nil},
+		{"030_up_upgrade_to_v1.2@staging", []string{"staging"}},
+		{"010_up_seed@@demo@", []string{"demo"}},
+		{"010_up_seed@", nil},
+		{"010_up_seed", nil},
+	}
+
+	for _, tt := range tests {
+		if got := nameTags(tt.name); !slices.Equal(got, tt.want) {
+			t.Errorf("nameTags(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFileTags(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{filepath.Join("scripts", "010_up_seed@staging@demo.js"), []string{"staging", "demo"}},
+		{"030_up_backfill@reporting.json", []string{"reporting"}},
+		{"030_up_upgrade_to_v1.2.js", nil},
+		{"040_up_clean.sh", nil},
+	}
+
+	for _, tt := range tests {
+		if got := fileTags(tt.path); !slices.Equal(got, tt.want) {
+			t.Errorf("fileTags(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseHeaderFileTags(t *testing.T) {
+	path := writeScript(t, "010_up_seed@staging.js", "// @tags demo\ndb.tenants.insertOne({});\n")
+
+	hdr, err := (&Migrator{}).parseHeader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(hdr.Tags, []string{"demo", "staging"}) {
+		t.Errorf("parseHeader() tags = %v, want the @tags directive followed by the filename tags", hdr.Tags)
+	}
+}
@@ -0,0 +1,63 @@
+package migrator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// helperDirName is the default helper directory inside the scripts directory
+const helperDirName = "_lib"
+
+// helperDir returns the directory holding the JS helpers loaded before every script
+func (m *Migrator) helperDir() string {
+	if m.HelperDir != "" {
+		return m.HelperDir
+	}
+	return filepath.Join(m.ScriptDir, helperDirName)
+}
+
+// loadHelpers returns the paths of the helper scripts ordered by name, or nil when there is no helper directory
+func (m *Migrator) loadHelpers() ([]string, error) {
+	files, err := os.ReadDir(m.helperDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read helper directory: %w", err)
+	}
+
+	var helpers []string
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".js") {
+			helpers = append(helpers, filepath.Join(m.helperDir(), file.Name()))
+		}
+	}
+	sort.Strings(helpers)
+
+	return helpers, nil
+}
+
+// helpersChecksum returns a combined checksum of the names and contents of all helpers, or an empty string when there are none
+func (m *Migrator) helpersChecksum() (string, error) {
+	helpers, err := m.loadHelpers()
+	if err != nil || len(helpers) == 0 {
+		return "", err
+	}
+
+	hash := sha256.New()
+	for _, helper := range helpers {
+		content, err := os.ReadFile(helper)
+		if err != nil {
+			return "", fmt.Errorf("failed to read helper %s: %w", helper, err)
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00", filepath.Base(helper), len(content))
+		hash.Write(content)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
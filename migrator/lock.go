@@ -0,0 +1,208 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	lockCollection = "migrations_lock"
+	lockID         = "lock"
+	// lockRetryInterval is how often a held lock is retried until LockTimeout expires
+	lockRetryInterval = time.Second
+	// defaultLockTTL is how long a lock outlives the last heartbeat of its holder when LockTTL is not set
+	defaultLockTTL = time.Minute
+)
+
+// LockInfo is the document held in the lock collection while a run is in progress
+type LockInfo struct {
+	ID         string    `bson:"_id" json:"-"`
+	Holder     string    `bson:"holder" json:"holder"`
+	AcquiredAt time.Time `bson:"acquiredAt" json:"acquiredAt"`
+	// RefreshedAt is the last heartbeat of the holder, the lock expires LockTTL after it
+	RefreshedAt time.Time `bson:"refreshedAt" json:"refreshedAt"`
+}
+
+// lockTTL returns how long a lock outlives the last heartbeat of its holder
+func (m *Migrator) lockTTL() time.Duration {
+	if m.LockTTL > 0 {
+		return m.LockTTL
+	}
+	return defaultLockTTL
+}
+
+// lock acquires the migration lock, waiting up to LockTimeout for another process to release it.
+// A lock whose holder stopped refreshing it for LockTTL, e.g. because it was killed, is taken over.
+// While the lock is held, a heartbeat refreshes it every third of LockTTL until the returned function releases it.
+func (m *Migrator) lock() (func(), error) {
+	collection := m.dbClient.Database(m.DBName).Collection(lockCollection)
+
+	holder := lockHolder()
+	deadline := time.Now().Add(m.LockTimeout)
+	for {
+		now := time.Now()
+		lock := LockInfo{ID: m.lockID(), Holder: holder, AcquiredAt: now, RefreshedAt: now}
+		_, err := collection.InsertOne(context.Background(), lock)
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+
+		taken, err := m.takeOverLock(lock)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			current, err := m.LockHolder()
+			if err != nil {
+				return nil, err
+			}
+			if current == nil {
+				return nil, ErrLocked
+			}
+			return nil, fmt.Errorf("%w: held by %s since %s", ErrLocked, current.Holder, current.AcquiredAt.Format(time.RFC3339))
+		}
+		time.Sleep(lockRetryInterval)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.heartbeat(holder, stop)
+	}()
+
+	release := func() {
+		close(stop)
+		<-done
+
+		_, err := collection.DeleteOne(context.Background(), bson.M{"_id": m.lockID(), "holder": holder})
+		if err != nil {
+			m.logger().Error("failed to release migration lock", "error", err)
+		}
+	}
+
+	return release, nil
+}
+
+// takeOverLock replaces the lock with the given one when its holder stopped refreshing it for LockTTL.
+// Locks written before heartbeats existed have no refreshedAt and expire LockTTL after acquiredAt.
+func (m *Migrator) takeOverLock(lock LockInfo) (bool, error) {
+	collection := m.dbClient.Database(m.DBName).Collection(lockCollection)
+
+	expired := lock.RefreshedAt.Add(-m.lockTTL())
+	filter := bson.M{
+		"_id": lock.ID,
+		"$or": bson.A{
+			bson.M{"refreshedAt": bson.M{"$lt": expired}},
+			bson.M{"refreshedAt": bson.M{"$exists": false}, "acquiredAt": bson.M{"$lt": expired}},
+		},
+	}
+
+	var previous LockInfo
+	err := collection.FindOneAndReplace(context.Background(), filter, lock).Decode(&previous)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to take over expired migration lock: %w", err)
+	}
+
+	m.logger().Warn("took over expired migration lock", "holder", previous.Holder, "acquiredAt", previous.AcquiredAt, "refreshedAt", previous.RefreshedAt)
+	return true, nil
+}
+
+// heartbeat refreshes the lock of holder until stop is closed, so other processes do not take it over while a run lasts
+func (m *Migrator) heartbeat(holder string, stop <-chan struct{}) {
+	collection := m.dbClient.Database(m.DBName).Collection(lockCollection)
+
+	ticker := time.NewTicker(m.lockTTL() / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		result, err := collection.UpdateOne(context.Background(),
+			bson.M{"_id": m.lockID(), "holder": holder},
+			bson.M{"$set": bson.M{"refreshedAt": time.Now()}},
+		)
+		if err != nil {
+			m.logger().Error("failed to refresh migration lock", "error", err)
+			continue
+		}
+		if result.MatchedCount == 0 {
+			m.logger().Error("migration lock was taken over by another process", "holder", holder)
+			return
+		}
+	}
+}
+
+// LockHolder returns the current lock, or nil when no run is in progress
+func (m *Migrator) LockHolder() (*LockInfo, error) {
+	collection := m.dbClient.Database(m.DBName).Collection(lockCollection)
+
+	var info LockInfo
+	err := collection.FindOne(context.Background(), bson.M{"_id": m.lockID()}).Decode(&info)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to fetch migration lock: %w", err)
+	}
+
+	return &info, nil
+}
+
+// Unlock force-releases the migration lock, e.g. after a process holding it crashed
+func (m *Migrator) Unlock() error {
+	collection := m.dbClient.Database(m.DBName).Collection(lockCollection)
+
+	if _, err := collection.DeleteOne(context.Background(), bson.M{"_id": m.lockID()}); err != nil {
+		return fmt.Errorf("failed to release migration lock: %w", err)
+	}
+
+	return nil
+}
+
+// lockHolder identifies the current process as host:pid
+func lockHolder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// run executes fn while holding the migration lock, wrapped by the migrate callbacks
+func (m *Migrator) run(direction string, fn func() error) (err error) {
+	start := time.Now()
+	defer func() {
+		m.emit(Event{Type: RunFinished, Direction: direction, Duration: time.Since(start), Err: err})
+		err = m.noChange(err)
+	}()
+
+	release, err := m.lock()
+	if err != nil {
+		return err
+	}
+	defer release()
+	m.emit(Event{Type: LockAcquired, Direction: direction, Duration: time.Since(start)})
+
+	return m.withCallbacks(fn)
+}
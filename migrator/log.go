@@ -0,0 +1,68 @@
+package migrator
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// maxOutput is how much of the output of a script is kept in its migration record
+const maxOutput = 64 * 1024
+
+// maxStderr is how much of the error output of a script is kept in a MigrationError
+const maxStderr = 4096
+
+// defaultLogger is used when the migrator has no Logger
+var defaultLogger = slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+// logger returns the configured logger or the default one
+func (m *Migrator) logger() *slog.Logger {
+	return loggerOrDefault(m.Logger)
+}
+
+// loggerOrDefault returns the given logger, or the default one when it is nil
+func loggerOrDefault(logger *slog.Logger) *slog.Logger {
+	if logger != nil {
+		return logger
+	}
+	return defaultLogger
+}
+
+// scriptWriters returns the writers mongosh output is sent to
+func (m *Migrator) scriptWriters() (stdout, stderr io.Writer) {
+	stdout, stderr = m.ScriptOutput, m.ScriptErrOutput
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	return stdout, stderr
+}
+
+// tailBuffer keeps the last limit bytes written to it, it is safe for concurrent writes
+type tailBuffer struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	limit int
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.buf.Write(p)
+	if overflow := t.buf.Len() - t.limit; overflow > 0 {
+		t.buf.Next(overflow)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.buf.String()
+}
@@ -0,0 +1,149 @@
+package migrator
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the migration duration histogram
+var durationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600}
+
+// Metrics collects migration metrics from the events of a migrator and serves them,
+// together with gauges of the current schema state, in the Prometheus text exposition format
+type Metrics struct {
+	migrator *Migrator
+
+	mu         sync.Mutex
+	applied    float64
+	rolledBack float64
+	failed     map[string]float64
+	durations  map[string]*histogram
+}
+
+// histogram is a cumulative Prometheus histogram
+type histogram struct {
+	counts []float64
+	count  float64
+	sum    float64
+}
+
+// NewMetrics creates metrics for a migrator and subscribes them to its events
+func NewMetrics(m *Migrator) *Metrics {
+	metrics := &Metrics{
+		migrator:  m,
+		failed:    make(map[string]float64),
+		durations: make(map[string]*histogram),
+	}
+	m.Subscribe(metrics.observe)
+	return metrics
+}
+
+// observe updates the counters and the duration histogram from a migration event
+func (mt *Metrics) observe(event Event) {
+	if event.Type != MigrationSucceeded && event.Type != MigrationFailed {
+		return
+	}
+
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	switch {
+	case event.Type == MigrationFailed:
+		mt.failed[event.Direction]++
+	case event.Direction == "down":
+		mt.rolledBack++
+	default:
+		mt.applied++
+	}
+
+	h, ok := mt.durations[event.Direction]
+	if !ok {
+		h = &histogram{counts: make([]float64, len(durationBuckets))}
+		mt.durations[event.Direction] = h
+	}
+	seconds := event.Duration.Seconds()
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (mt *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status, err := mt.migrator.Status()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	mt.write(w, status)
+}
+
+// write renders the counters, the histogram and the gauges derived from status
+func (mt *Metrics) write(w io.Writer, status *Status) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	writeMetric(w, "migrongo_migrations_applied_total", "counter", "Migrations applied.", "", mt.applied)
+	writeMetric(w, "migrongo_migrations_rolled_back_total", "counter", "Migrations rolled back.", "", mt.rolledBack)
+
+	fmt.Fprintf(w, "# HELP migrongo_migrations_failed_total Migrations that failed.\n# TYPE migrongo_migrations_failed_total counter\n")
+	for _, direction := range sortedKeys(mt.failed) {
+		fmt.Fprintf(w, "migrongo_migrations_failed_total{direction=%q} %s\n", direction, formatFloat(mt.failed[direction]))
+	}
+
+	fmt.Fprintf(w, "# HELP migrongo_migration_duration_seconds Duration of migration scripts.\n# TYPE migrongo_migration_duration_seconds histogram\n")
+	for _, direction := range sortedKeys(mt.durations) {
+		h := mt.durations[direction]
+		for i, bound := range durationBuckets {
+			fmt.Fprintf(w, "migrongo_migration_duration_seconds_bucket{direction=%q,le=%q} %s\n", direction, formatFloat(bound), formatFloat(h.counts[i]))
+		}
+		fmt.Fprintf(w, "migrongo_migration_duration_seconds_bucket{direction=%q,le=\"+Inf\"} %s\n", direction, formatFloat(h.count))
+		fmt.Fprintf(w, "migrongo_migration_duration_seconds_sum{direction=%q} %s\n", direction, formatFloat(h.sum))
+		fmt.Fprintf(w, "migrongo_migration_duration_seconds_count{direction=%q} %s\n", direction, formatFloat(h.count))
+	}
+
+	// Versions are strings, the numeric gauge is only exported when the version is a number
+	if version, err := strconv.ParseFloat(status.CurrentVersion, 64); err == nil {
+		writeMetric(w, "migrongo_current_version", "gauge", "Highest applied migration version.", "", version)
+	}
+	writeMetric(w, "migrongo_schema_info", "gauge", "Highest applied migration version as a label.",
+		fmt.Sprintf("{version=%q}", status.CurrentVersion), 1)
+	writeMetric(w, "migrongo_pending_migrations", "gauge", "Migrations not applied yet.", "", float64(len(status.Pending)))
+	writeMetric(w, "migrongo_dirty", "gauge", "Whether a run stopped halfway through a migration.", "", boolToFloat(status.Dirty))
+	writeMetric(w, "migrongo_lock_held", "gauge", "Whether a run holds the migration lock.", "", boolToFloat(status.Lock != nil))
+}
+
+// writeMetric writes a metric with a single sample
+func writeMetric(w io.Writer, name, kind, help, labels string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s%s %s\n", name, help, name, kind, name, labels, formatFloat(value))
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// sortedKeys returns the keys of a map in order, so the exposition output is stable
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
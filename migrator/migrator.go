@@ -5,8 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
+	"io"
+	"log/slog"
 	"os"
 	"os/exec"
+	"sync"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
@@ -14,11 +17,83 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
+// MigrationRecord is a document in the migrations collection
+type MigrationRecord struct {
+	Version          string    `bson:"version,omitempty"`
+	AppliedAt        time.Time `bson:"appliedAt"`
+	Baselined        bool      `bson:"baselined,omitempty"`
+	Description      string    `bson:"description,omitempty"`
+	Checksum         string    `bson:"checksum,omitempty"`
+	RenderedChecksum string    `bson:"renderedChecksum,omitempty"`
+	HelpersChecksum  string    `bson:"helpersChecksum,omitempty"`
+	Repeatable       string    `bson:"repeatable,omitempty"`
+	// Dirty is set while the script of the migration runs and stays set if it fails
+	Dirty bool `bson:"dirty,omitempty"`
+	// DirtyDirection is the direction of the script that set Dirty
+	DirtyDirection string `bson:"dirtyDirection,omitempty"`
+	// Output is the captured output of the script when CaptureOutput is set, or the error output of a failed script
+	Output string `bson:"output,omitempty"`
+	// ExitCode is the exit code of the failed script that left the record dirty
+	ExitCode int `bson:"exitCode,omitempty"`
+	// Stream is the migration stream the record belongs to, empty for the default stream
+	Stream string `bson:"stream,omitempty"`
+	// Matched and Modified are the document counts reported by pipeline migrations
+	Matched  int64 `bson:"matched,omitempty"`
+	Modified int64 `bson:"modified,omitempty"`
+}
+
 type Migrator struct {
 	ScriptDir          string
 	DBName             string
 	MongoClientOptions *options.ClientOptions
-	dbClient           *mongo.Client
+	// Stream namespaces the records and the lock of this migrator, so services sharing a database
+	// can version their own scripts directories independently
+	Stream string
+	// StrictDirectives rejects scripts whose header contains unknown directives
+	StrictDirectives bool
+	// Tags restricts Up and Down to migrations tagged with at least one of these tags
+	Tags []string
+	// ExcludeTags skips migrations tagged with any of these tags
+	ExcludeTags []string
+	// Environment is matched against the @env directive, migrations limited to other environments are skipped
+	Environment string
+	// ReportNoChange makes Up, Down, DownTo, Baseline, Seed and Reseed return ErrNoChange instead of nil when there was nothing to do
+	ReportNoChange bool
+	// RequireDown makes Up refuse migrations that have no down script and are not marked @no-down
+	RequireDown bool
+	// ForceRollback lets Down and DownTo cross migrations that cannot be rolled back
+	ForceRollback bool
+	// Placeholders enables text/template rendering of scripts with these values before they are run
+	Placeholders map[string]string
+	// HelperDir holds JS helpers loaded before every script, defaults to the _lib directory of ScriptDir
+	HelperDir string
+	// DataMode is how data migrations write their documents, defaults to DataUpsert
+	DataMode DataMode
+	// SeedDir holds the seeds applied by Seed, defaults to the seeds directory of ScriptDir
+	SeedDir string
+	// Params are EJSON encoded and exposed to every script as the params global
+	Params map[string]any
+	// Workers is how many independent migrations Up may apply at once, following their @depends-on graph.
+	// Event subscribers and hooks must be safe for concurrent use when it is above 1.
+	Workers int
+	// LockTimeout is how long a run waits for another process to release the migration lock
+	LockTimeout time.Duration
+	// LockTTL is how long the migration lock outlives the last heartbeat of its holder before another process
+	// may take it over, defaults to one minute. The holder refreshes the lock every third of LockTTL.
+	LockTTL time.Duration
+	// Logger receives structured logs of runs, defaults to a text logger writing to stdout
+	Logger *slog.Logger
+	// ScriptOutput and ScriptErrOutput receive the output of mongosh, default to stdout and stderr
+	ScriptOutput    io.Writer
+	ScriptErrOutput io.Writer
+	// CaptureOutput stores the tail of the output of each script in its migration record
+	CaptureOutput bool
+	// Hooks are Go callbacks invoked around runs and around every migration script
+	Hooks          Hooks
+	dbClient       *mongo.Client
+	subscribers    []func(Event)
+	mongoVersion   string
+	mongoVersionMu sync.Mutex
 }
 
 // NewMigrator creates a new Migrator instance
@@ -27,14 +102,30 @@ func NewMigrator(mongoClientOptions *options.ClientOptions, dbName, scriptDir st
 		return nil, errors.New("db name cannot be empty")
 	}
 
-	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(mongoClientOptions.GetURI()))
+	var uri = mongoClientOptions.GetURI()
+
+	client, err := mongo.Connect(context.Background(), mongoClientOptions)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+		return nil, fmt.Errorf("failed to connect to MongoDB at %s: %w", redactURI(uri), redactError(err, uri))
 	}
 
 	// Verify connection
 	if err := client.Ping(context.Background(), readpref.Primary()); err != nil {
-		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("failed to ping MongoDB at %s: %w", redactURI(uri), redactError(err, uri))
+	}
+
+	return NewMigratorWithClient(client, mongoClientOptions, dbName, scriptDir)
+}
+
+// NewMigratorWithClient creates a new Migrator instance that shares an already connected client.
+// The client options are still required, mongosh connects with their URI.
+func NewMigratorWithClient(client *mongo.Client, mongoClientOptions *options.ClientOptions, dbName, scriptDir string) (*Migrator, error) {
+	if dbName == "" {
+		return nil, errors.New("db name cannot be empty")
+	}
+	if client == nil {
+		return nil, errors.New("client cannot be nil")
 	}
 
 	return &Migrator{
@@ -45,26 +136,106 @@ func NewMigrator(mongoClientOptions *options.ClientOptions, dbName, scriptDir st
 	}, nil
 }
 
-// runScript executes a given JavaScript file using mongosh
-func (m *Migrator) runScript(scriptPath string) error {
-	var dbURI = m.MongoClientOptions.GetURI()
+// runScript executes a given JavaScript file using mongosh, honoring the timeout and transaction directives of its header.
+// The script is loaded through a generated wrapper script that connects to the database, so credentials never
+// appear on the mongosh command line. It returns the captured output of the script when CaptureOutput is set.
+func (m *Migrator) runScript(scriptPath string, hdr header) (string, error) {
+	run, cleanup, err := m.scriptStep(scriptPath, hdr)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	out, err := run()
+	return out.Output, err
+}
+
+// scriptStep checks the server version of a script, renders it and writes its wrapper, and returns the function
+// running it with mongosh. The returned cleanup function removes the temporary files once the script ran.
+func (m *Migrator) scriptStep(scriptPath string, hdr header) (stepFunc, func(), error) {
+	if err := m.checkServerVersion(hdr.RequiresServer); err != nil {
+		return nil, nil, fmt.Errorf("cannot run script %s: %w", scriptPath, err)
+	}
+
+	filePath, cleanupScript, err := m.prepareScript(scriptPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	helpers, err := m.loadHelpers()
+	if err != nil {
+		cleanupScript()
+		return nil, nil, err
+	}
+
+	wrapperPath, err := m.writeWrapper(filePath, hdr, helpers)
+	if err != nil {
+		cleanupScript()
+		return nil, nil, err
+	}
+
+	cleanup := func() {
+		os.Remove(wrapperPath)
+		cleanupScript()
+	}
+	run := func() (outcome, error) {
+		ctx := context.Background()
+		if hdr.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, hdr.Timeout)
+			defer cancel()
+		}
+
+		output, err := m.runProcess(ctx, exec.CommandContext(ctx, "mongosh", "--nodb", "--file", wrapperPath), scriptPath, hdr)
+		return outcome{Output: output}, err
+	}
+
+	return run, cleanup, nil
+}
+
+// runProcess runs the command of a migration script, created with the timeout context of its header, and returns
+// its captured output. A failed or timed out command is returned as a *MigrationError.
+func (m *Migrator) runProcess(ctx context.Context, cmd *exec.Cmd, scriptPath string, hdr header) (string, error) {
+	stdout, stderr := m.scriptWriters()
+	errTail := &tailBuffer{limit: maxStderr}
+	var output *tailBuffer
+	if m.CaptureOutput {
+		output = &tailBuffer{limit: maxOutput}
+		stdout = io.MultiWriter(stdout, output)
+		stderr = io.MultiWriter(stderr, output)
+	}
 
-	cmd := exec.Command("mongosh", dbURI, "--file", scriptPath)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = stdout
+	cmd.Stderr = io.MultiWriter(stderr, errTail)
 
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to run script %s: %w", scriptPath, err)
+		migErr := &MigrationError{
+			Script:   scriptPath,
+			ExitCode: -1,
+			Stderr:   redactString(errTail.String(), m.connectionURI()),
+			Err:      err,
+		}
+		if cmd.ProcessState != nil {
+			migErr.ExitCode = cmd.ProcessState.ExitCode()
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			migErr.Err = fmt.Errorf("timed out after %s: %w", hdr.Timeout, ctx.Err())
+		}
+		return "", migErr
 	}
 
-	return nil
+	if output == nil {
+		return "", nil
+	}
+	return redactString(output.String(), m.connectionURI()), nil
 }
 
 // AppliedMigrations retrieves applied migration versions from the migrations collection in the specified database
 func (m *Migrator) appliedMigrations() (map[string]bool, error) {
 	collection := m.dbClient.Database(m.DBName).Collection("migrations")
 
-	cursor, err := collection.Find(context.Background(), bson.M{})
+	// A dirty record belongs to a migration that failed halfway, it is not applied
+	cursor, err := collection.Find(context.Background(), m.scope(bson.M{"dirty": bson.M{"$ne": true}}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch applied migrations: %w", err)
 	}
@@ -72,13 +243,12 @@ func (m *Migrator) appliedMigrations() (map[string]bool, error) {
 
 	applied := make(map[string]bool)
 	for cursor.Next(context.Background()) {
-		var result bson.M
-		if err := cursor.Decode(&result); err != nil {
+		var record MigrationRecord
+		if err := cursor.Decode(&record); err != nil {
 			return nil, fmt.Errorf("failed to decode applied migration: %w", err)
 		}
-		version, ok := result["version"].(string)
-		if ok {
-			applied[version] = true
+		if record.Version != "" {
+			applied[record.Version] = true
 		}
 	}
 
@@ -92,14 +262,39 @@ func (m *Migrator) appliedMigrations() (map[string]bool, error) {
 }
 
 // recordMigration records a migration as applied in the database
-func (m *Migrator) recordMigration(version string) error {
+func (m *Migrator) recordMigration(mig *migration, out outcome) error {
 	var db = m.DBName
 	collection := m.dbClient.Database(db).Collection("migrations")
 
-	_, err := collection.InsertOne(context.Background(), map[string]interface{}{
-		"version":   version,
-		"appliedAt": time.Now(),
-	})
+	checksum, err := mig.checksum()
+	if err != nil {
+		return err
+	}
+
+	// Rendering and helpers only apply to mongosh scripts
+	var renderedChecksum, helpersChecksum string
+	if mig.Kind == scriptMigration {
+		if renderedChecksum, err = m.renderedChecksum(mig.UpPath); err != nil {
+			return err
+		}
+		if helpersChecksum, err = m.helpersChecksum(); err != nil {
+			return err
+		}
+	}
+
+	// Replacing the record also clears the dirty flag set before the script ran
+	_, err = collection.ReplaceOne(context.Background(), m.scope(bson.M{"version": mig.Version}), MigrationRecord{
+		Version:          mig.Version,
+		Stream:           m.Stream,
+		AppliedAt:        time.Now(),
+		Description:      mig.Header.Description,
+		Checksum:         checksum,
+		RenderedChecksum: renderedChecksum,
+		HelpersChecksum:  helpersChecksum,
+		Output:           out.Output,
+		Matched:          out.Matched,
+		Modified:         out.Modified,
+	}, options.Replace().SetUpsert(true))
 	if err != nil {
 		return fmt.Errorf("failed to record migration: %w", err)
 	}
@@ -112,12 +307,26 @@ func (m *Migrator) removeMigrationRecord(version string) error {
 	var db = m.DBName
 	collection := m.dbClient.Database(db).Collection("migrations")
 
-	_, err := collection.DeleteOne(context.Background(), map[string]interface{}{
+	_, err := collection.DeleteOne(context.Background(), m.scope(bson.M{
 		"version": version,
-	})
+	}))
 	if err != nil {
 		return fmt.Errorf("failed to remove migration record: %w", err)
 	}
 
 	return nil
 }
+
+// removeMigrationRange removes the records of all migrations between from and to (inclusive)
+func (m *Migrator) removeMigrationRange(from, to string) error {
+	collection := m.dbClient.Database(m.DBName).Collection("migrations")
+
+	_, err := collection.DeleteMany(context.Background(), m.scope(bson.M{
+		"version": bson.M{"$gte": from, "$lte": to},
+	}))
+	if err != nil {
+		return fmt.Errorf("failed to remove migration records: %w", err)
+	}
+
+	return nil
+}
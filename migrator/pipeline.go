@@ -0,0 +1,231 @@
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// pipelineSpec is the EJSON document of a pipeline migration, e.g. 030_up_backfill_totals.json
+type pipelineSpec struct {
+	Collection string `bson:"collection"`
+	// Operation is update, running updateMany(filter, pipeline), or aggregate, running the pipeline
+	// after a $match on the filter, typically ending in $merge or $out. It defaults to update.
+	Operation string   `bson:"operation"`
+	Filter    bson.D   `bson:"filter"`
+	Pipeline  []bson.D `bson:"pipeline"`
+	// Hint is an index name or key document
+	Hint any `bson:"hint"`
+	// BatchSize splits updates into batches of documents ordered by _id, and sets the cursor batch size of aggregations
+	BatchSize int32 `bson:"batchSize"`
+
+	// The optional directives of the migration, as in the header of a script
+	Description    string   `bson:"description"`
+	Timeout        string   `bson:"timeout"`
+	RequiresServer string   `bson:"requiresServer"`
+	Tags           []string `bson:"tags"`
+	NoDown         bool     `bson:"noDown"`
+	DependsOn      []string `bson:"dependsOn"`
+	Env            []string `bson:"env"`
+}
+
+// readPipelineSpec parses and checks the EJSON document of a pipeline migration
+func readPipelineSpec(path string) (*pipelineSpec, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pipeline %s: %w", path, err)
+	}
+
+	var spec pipelineSpec
+	if err := bson.UnmarshalExtJSON(content, false, &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse pipeline %s: %w", path, err)
+	}
+
+	if spec.Collection == "" {
+		return nil, fmt.Errorf("pipeline %s has no collection", path)
+	}
+	if len(spec.Pipeline) == 0 {
+		return nil, fmt.Errorf("pipeline %s has no stages", path)
+	}
+	if spec.Filter == nil {
+		spec.Filter = bson.D{}
+	}
+	switch spec.Operation {
+	case "":
+		spec.Operation = "update"
+	case "update", "aggregate":
+	default:
+		return nil, fmt.Errorf("pipeline %s has unknown operation %q", path, spec.Operation)
+	}
+
+	return &spec, nil
+}
+
+// pipelineHeader returns the directives declared by the fields of a pipeline migration
+func pipelineHeader(path string) (header, error) {
+	var hdr header
+
+	spec, err := readPipelineSpec(path)
+	if err != nil {
+		return hdr, err
+	}
+
+	directives := []struct{ name, value string }{
+		{"description", spec.Description},
+		{"timeout", spec.Timeout},
+		{"requires-server", spec.RequiresServer},
+		{"tags", strings.Join(spec.Tags, ",")},
+		{"env", strings.Join(spec.Env, ",")},
+		{"depends-on", strings.Join(spec.DependsOn, ",")},
+	}
+	for _, directive := range directives {
+		if directive.value == "" {
+			continue
+		}
+		if err := hdr.apply(directive.name, directive.value); err != nil {
+			return hdr, fmt.Errorf("invalid directive in %s: %w", path, err)
+		}
+	}
+	hdr.NoDown = spec.NoDown
+	hdr.Tags = append(hdr.Tags, fileTags(path)...)
+
+	return hdr, nil
+}
+
+// pipelineStep reads and checks a pipeline migration and returns the function executing it through the driver,
+// which reports the matched and modified counts
+func (m *Migrator) pipelineStep(path string, hdr header) (stepFunc, error) {
+	spec, err := readPipelineSpec(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.checkServerVersion(hdr.RequiresServer); err != nil {
+		return nil, fmt.Errorf("cannot run pipeline %s: %w", path, err)
+	}
+
+	return func() (outcome, error) {
+		ctx := context.Background()
+		if hdr.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, hdr.Timeout)
+			defer cancel()
+		}
+
+		collection := m.dbClient.Database(m.DBName).Collection(spec.Collection)
+
+		var out outcome
+		if spec.Operation == "aggregate" {
+			err = m.aggregatePipeline(ctx, collection, spec)
+		} else {
+			out, err = m.updatePipeline(ctx, collection, spec)
+		}
+		if err != nil {
+			return out, &MigrationError{Script: path, Err: err}
+		}
+
+		out.Output = fmt.Sprintf("%s: %d matched, %d modified\n", spec.Collection, out.Matched, out.Modified)
+		return out, nil
+	}, nil
+}
+
+// updatePipeline runs updateMany with the pipeline, in batches of _id ranges when BatchSize is set
+func (m *Migrator) updatePipeline(ctx context.Context, collection *mongo.Collection, spec *pipelineSpec) (outcome, error) {
+	var out outcome
+
+	update := func(filter any) error {
+		opts := options.Update()
+		if spec.Hint != nil {
+			opts.SetHint(spec.Hint)
+		}
+		result, err := collection.UpdateMany(ctx, filter, spec.Pipeline, opts)
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", spec.Collection, err)
+		}
+		out.Matched += result.MatchedCount
+		out.Modified += result.ModifiedCount
+		return nil
+	}
+
+	if spec.BatchSize <= 0 {
+		return out, update(spec.Filter)
+	}
+
+	// Batches follow _id order, so documents the pipeline keeps matching the filter are not visited twice
+	var lastID any
+	for {
+		filter := spec.Filter
+		if lastID != nil {
+			filter = bson.D{{Key: "$and", Value: bson.A{spec.Filter, bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: lastID}}}}}}}
+		}
+
+		opts := options.Find().
+			SetProjection(bson.D{{Key: "_id", Value: 1}}).
+			SetSort(bson.D{{Key: "_id", Value: 1}}).
+			SetLimit(int64(spec.BatchSize))
+		if spec.Hint != nil {
+			opts.SetHint(spec.Hint)
+		}
+
+		cursor, err := collection.Find(ctx, filter, opts)
+		if err != nil {
+			return out, fmt.Errorf("failed to fetch batch of %s: %w", spec.Collection, err)
+		}
+		var batch []struct {
+			ID any `bson:"_id"`
+		}
+		if err := cursor.All(ctx, &batch); err != nil {
+			return out, fmt.Errorf("failed to decode batch of %s: %w", spec.Collection, err)
+		}
+		if len(batch) == 0 {
+			return out, nil
+		}
+
+		ids := make(bson.A, 0, len(batch))
+		for _, doc := range batch {
+			ids = append(ids, doc.ID)
+		}
+		if err := update(bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}); err != nil {
+			return out, err
+		}
+
+		lastID = batch[len(batch)-1].ID
+		m.logger().Debug("pipeline batch applied", "collection", spec.Collection, "documents", len(batch), "matched", out.Matched, "modified", out.Modified)
+	}
+}
+
+// aggregatePipeline runs the pipeline as an aggregation, preceded by a $match on the filter when one is set
+func (m *Migrator) aggregatePipeline(ctx context.Context, collection *mongo.Collection, spec *pipelineSpec) error {
+	stages := spec.Pipeline
+	if len(spec.Filter) > 0 {
+		stages = append([]bson.D{{{Key: "$match", Value: spec.Filter}}}, stages...)
+	}
+
+	opts := options.Aggregate()
+	if spec.Hint != nil {
+		opts.SetHint(spec.Hint)
+	}
+	if spec.BatchSize > 0 {
+		opts.SetBatchSize(spec.BatchSize)
+	}
+
+	cursor, err := collection.Aggregate(ctx, stages, opts)
+	if err != nil {
+		return fmt.Errorf("failed to aggregate %s: %w", spec.Collection, err)
+	}
+	defer cursor.Close(ctx)
+
+	// Documents returned by pipelines without $merge or $out are discarded
+	for cursor.Next(ctx) {
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to aggregate %s: %w", spec.Collection, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package migrator
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writePipeline writes a pipeline migration into a temporary directory and returns its path
+func writePipeline(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadPipelineSpec(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		operation string
+		wantErr   string
+	}{
+		{"update by default", `{"collection": "orders", "pipeline": [{"$set": {"total": 1}}]}`, "update", ""},
+		{"aggregate", `{"collection": "orders", "operation": "aggregate", "pipeline": [{"$merge": "totals"}]}`, "aggregate", ""},
+		{"filter and batch size", `{"collection": "orders", "filter": {"total": {"$exists": false}}, "batchSize": 500, "pipeline": [{"$set": {"total": 1}}]}`, "update", ""},
+		{"unknown operation", `{"collection": "orders", "operation": "delete", "pipeline": [{"$set": {"total": 1}}]}`, "", `unknown operation "delete"`},
+		{"no collection", `{"pipeline": [{"$set": {"total": 1}}]}`, "", "has no collection"},
+		{"no stages", `{"collection": "orders", "pipeline": []}`, "", "has no stages"},
+		{"invalid json", `{"collection": "orders",`, "", "failed to parse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := readPipelineSpec(writePipeline(t, "030_up_backfill_totals.json", tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readPipelineSpec() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spec.Operation != tt.operation {
+				t.Errorf("readPipelineSpec() operation = %q, want %q", spec.Operation, tt.operation)
+			}
+			if spec.Filter == nil {
+				t.Error("readPipelineSpec() left the filter nil")
+			}
+		})
+	}
+}
+
+func TestPipelineHeader(t *testing.T) {
+	path := writePipeline(t, "030_up_backfill_totals@reporting.json", `{
+		"collection": "orders",
+		"pipeline": [{"$set": {"total": 1}}],
+		"description": "backfill order totals",
+		"timeout": "10m",
+		"requiresServer": ">=6.0",
+		"tags": ["backfill"],
+		"env": ["staging", "dev"],
+		"dependsOn": ["010", "020"],
+		"noDown": true
+	}`)
+
+	hdr, err := pipelineHeader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hdr.Description != "backfill order totals" || hdr.Timeout != 10*time.Minute || hdr.RequiresServer != ">=6.0" || !hdr.NoDown {
+		t.Errorf("pipelineHeader() = %+v, want the directives of the document", hdr)
+	}
+	if !slices.Equal(hdr.Tags, []string{"backfill", "reporting"}) {
+		t.Errorf("pipelineHeader() tags = %v, want [backfill reporting]", hdr.Tags)
+	}
+	if !slices.Equal(hdr.Environments, []string{"staging", "dev"}) || !slices.Equal(hdr.DependsOn, []string{"010", "020"}) {
+		t.Errorf("pipelineHeader() environments = %v, depends on = %v", hdr.Environments, hdr.DependsOn)
+	}
+}
+
+func TestPipelineHeaderInvalidDirectives(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+	}{
+		{"timeout", `"timeout": "soon"`},
+		{"negative timeout", `"timeout": "-1m"`},
+		{"server constraint", `"requiresServer": ">=six"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writePipeline(t, "030_up_backfill_totals.json", `{"collection": "orders", "pipeline": [{"$set": {"total": 1}}], `+tt.field+`}`)
+			if _, err := pipelineHeader(path); err == nil || !strings.Contains(err.Error(), "invalid directive") {
+				t.Errorf("pipelineHeader() error = %v, want an invalid directive", err)
+			}
+		})
+	}
+}
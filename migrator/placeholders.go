@@ -0,0 +1,89 @@
+package migrator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// renderScript renders the placeholders of a script with text/template, e.g. {{ .prefix }} or {{ env "TTL" }}.
+// Scripts are returned unchanged when the migrator has no Placeholders configured.
+func (m *Migrator) renderScript(scriptPath string) ([]byte, error) {
+	content, err := os.ReadFile(scriptPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script %s: %w", scriptPath, err)
+	}
+
+	if m.Placeholders == nil {
+		return content, nil
+	}
+
+	tmpl, err := template.New(filepath.Base(scriptPath)).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"env": lookupEnv}).
+		Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse placeholders in %s: %w", scriptPath, err)
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, m.Placeholders); err != nil {
+		return nil, fmt.Errorf("failed to render placeholders in %s: %w", scriptPath, err)
+	}
+
+	return rendered.Bytes(), nil
+}
+
+// prepareScript returns the path of the script mongosh should run: the script itself,
+// or a rendered temporary copy that the returned cleanup function removes
+func (m *Migrator) prepareScript(scriptPath string) (string, func(), error) {
+	if m.Placeholders == nil {
+		return scriptPath, func() {}, nil
+	}
+
+	rendered, err := m.renderScript(scriptPath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	file, err := os.CreateTemp("", "migrongo-rendered-*.js")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create rendered script: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(rendered); err != nil {
+		os.Remove(file.Name())
+		return "", nil, fmt.Errorf("failed to write rendered script: %w", err)
+	}
+
+	return file.Name(), func() { os.Remove(file.Name()) }, nil
+}
+
+// renderedChecksum returns the checksum of the rendered script, or an empty string when placeholders are not used
+func (m *Migrator) renderedChecksum(scriptPath string) (string, error) {
+	if m.Placeholders == nil {
+		return "", nil
+	}
+
+	rendered, err := m.renderScript(scriptPath)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(rendered)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// lookupEnv returns the value of an environment variable and fails when it is not set
+func lookupEnv(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
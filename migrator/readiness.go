@@ -0,0 +1,89 @@
+package migrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// StatusHandler returns an http.Handler serving the Status of the database as JSON
+func (m *Migrator) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, err := m.Status()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			m.logger().Error("failed to write status", "error", err)
+		}
+	})
+}
+
+// RequireVersion returns ErrNotReady unless the database is clean and at or past minVersion.
+// It only reads the migrations collection, so services that do not ship the scripts directory can use it.
+func (m *Migrator) RequireVersion(ctx context.Context, minVersion string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	dirtyVersion, err := m.dirtyVersion()
+	if err != nil {
+		return err
+	}
+	if dirtyVersion != "" {
+		return fmt.Errorf("%w: migration %s is dirty", ErrNotReady, dirtyVersion)
+	}
+
+	currentVersion, err := m.LatestVersion()
+	if err != nil {
+		return err
+	}
+	if currentVersion < minVersion {
+		return fmt.Errorf("%w: database is at %q, expected at least %q", ErrNotReady, currentVersion, minVersion)
+	}
+
+	return nil
+}
+
+// WaitForVersion blocks until another process brought the database to at least version,
+// polling every pollInterval until the context is done
+func (m *Migrator) WaitForVersion(ctx context.Context, version string, pollInterval time.Duration) error {
+	if pollInterval <= 0 {
+		return fmt.Errorf("poll interval must be positive, got %s", pollInterval)
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		err := m.RequireVersion(ctx, version)
+		if err == nil {
+			return nil
+		}
+
+		m.logger().Debug("waiting for schema version", "version", version, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for version %s: %w", version, err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReadinessHandler returns an http.Handler that responds 200 when the database is at or past minVersion
+// and 503 otherwise, for use as a readiness probe
+func (m *Migrator) ReadinessHandler(minVersion string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := m.RequireVersion(r.Context(), minVersion); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
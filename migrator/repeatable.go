@@ -0,0 +1,183 @@
+package migrator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// repeatablePrefix marks scripts that are re-run whenever their content changes, e.g. R_refresh_views.js
+const repeatablePrefix = "R_"
+
+// repeatable is a script that is re-executed after versioned migrations whenever its checksum changes
+type repeatable struct {
+	Name   string
+	Path   string
+	Header header
+}
+
+// loadRepeatables reads the repeatable scripts of the scripts directory ordered by name
+func (m *Migrator) loadRepeatables() ([]*repeatable, error) {
+	files, err := os.ReadDir(m.ScriptDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script directory: %w", err)
+	}
+
+	var repeatables []*repeatable
+	for _, file := range files {
+		if file.IsDir() || !isRepeatable(file.Name()) {
+			continue
+		}
+
+		scriptPath := filepath.Join(m.ScriptDir, file.Name())
+		hdr, err := m.parseHeader(scriptPath)
+		if err != nil {
+			return nil, err
+		}
+
+		repeatables = append(repeatables, &repeatable{
+			Name:   file.Name(),
+			Path:   scriptPath,
+			Header: hdr,
+		})
+	}
+
+	sort.Slice(repeatables, func(i, j int) bool {
+		return repeatables[i].Name < repeatables[j].Name
+	})
+
+	return repeatables, nil
+}
+
+// isRepeatable reports whether a filename names a repeatable script
+func isRepeatable(fileName string) bool {
+	return strings.HasPrefix(fileName, repeatablePrefix) && strings.HasSuffix(fileName, ".js")
+}
+
+// runRepeatables executes every repeatable script whose source, rendered or helpers checksum differs from its last recorded run
+// and returns how many of them ran
+func (m *Migrator) runRepeatables() (int, error) {
+	repeatables, err := m.loadRepeatables()
+	if err != nil {
+		return 0, err
+	}
+	if len(repeatables) == 0 {
+		return 0, nil
+	}
+
+	records, err := m.repeatableRecords()
+	if err != nil {
+		return 0, err
+	}
+
+	helpersChecksum, err := m.helpersChecksum()
+	if err != nil {
+		return 0, err
+	}
+
+	var ran int
+
+	for _, rep := range repeatables {
+		if !m.selected(rep.Header) {
+			continue
+		}
+
+		checksum, err := fileChecksum(rep.Path)
+		if err != nil {
+			return ran, err
+		}
+
+		renderedChecksum, err := m.renderedChecksum(rep.Path)
+		if err != nil {
+			return ran, err
+		}
+
+		last := records[rep.Name]
+		if last.Checksum == checksum && last.RenderedChecksum == renderedChecksum && last.HelpersChecksum == helpersChecksum {
+			m.logger().Debug("repeatable migration unchanged, skipping", "script", rep.Name)
+			continue
+		}
+
+		err = m.step("up", rep.Name, rep.Path, func() error {
+			output, err := m.runScript(rep.Path, rep.Header)
+			if err != nil {
+				return withMigration(err, rep.Name, "up")
+			}
+			return m.recordRepeatable(rep, MigrationRecord{
+				Checksum:         checksum,
+				RenderedChecksum: renderedChecksum,
+				HelpersChecksum:  helpersChecksum,
+				Output:           output,
+			})
+		})
+		if err != nil {
+			return ran, err
+		}
+		ran++
+	}
+
+	return ran, nil
+}
+
+// repeatableRecords returns the record of the last run of every repeatable script
+func (m *Migrator) repeatableRecords() (map[string]MigrationRecord, error) {
+	collection := m.dbClient.Database(m.DBName).Collection("migrations")
+
+	cursor, err := collection.Find(context.Background(), m.scope(bson.M{"repeatable": bson.M{"$exists": true}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch repeatable migrations: %w", err)
+	}
+	defer cursor.Close(context.Background())
+
+	records := make(map[string]MigrationRecord)
+	for cursor.Next(context.Background()) {
+		var record MigrationRecord
+		if err := cursor.Decode(&record); err != nil {
+			return nil, fmt.Errorf("failed to decode repeatable migration: %w", err)
+		}
+		records[record.Repeatable] = record
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error encountered while iterating cursor: %w", err)
+	}
+
+	return records, nil
+}
+
+// recordRepeatable stores the checksums of the latest run of a repeatable script
+func (m *Migrator) recordRepeatable(rep *repeatable, record MigrationRecord) error {
+	collection := m.dbClient.Database(m.DBName).Collection("migrations")
+
+	record.Repeatable = rep.Name
+	record.AppliedAt = time.Now()
+	record.Description = rep.Header.Description
+	record.Stream = m.Stream
+
+	_, err := collection.ReplaceOne(context.Background(), m.scope(bson.M{"repeatable": rep.Name}), record, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to record repeatable migration: %w", err)
+	}
+
+	return nil
+}
+
+// fileChecksum returns the hex encoded SHA-256 checksum of a file
+func fileChecksum(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read script %s: %w", path, err)
+	}
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,155 @@
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Rollout describes a staged rollout across tenants: a canary wave first, then waves of WaveSize tenants
+type Rollout struct {
+	// Canary lists the tenants migrated in the first wave
+	Canary []string
+	// WaveSize is the number of tenants per wave after the canary, defaults to all remaining tenants
+	WaveSize int
+	// Pause is the time to wait between waves
+	Pause time.Duration
+	// MaxFailureRate halts the rollout when the share of failed tenants in a wave exceeds it, from 0 to 1
+	MaxFailureRate float64
+	// TargetVersion, when set, skips tenants that are already at or past it, so a halted rollout can be resumed
+	TargetVersion string
+}
+
+// RolloutReport is the outcome of a rollout
+type RolloutReport struct {
+	// Waves holds the results of every wave that ran, the canary first
+	Waves [][]TenantResult
+	// Halted is set when a wave exceeded MaxFailureRate or the context was cancelled
+	Halted     bool
+	HaltReason string
+	// Versions maps every tenant to its current version, including tenants the rollout did not reach
+	Versions map[string]string
+}
+
+// Rollout runs fn on the tenants wave by wave and halts when a wave fails too often.
+// Failures inside a wave never stop the other tenants of the wave, so its failure rate is complete.
+func (r *TenantRunner) Rollout(ctx context.Context, rollout Rollout, fn func(*Migrator) error) (*RolloutReport, error) {
+	tenants, err := r.tenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RolloutReport{Versions: make(map[string]string)}
+	all := append(append([]string{}, rollout.Canary...), tenants...)
+
+	// Tenants that already reached the target are done, which lets a halted rollout resume where it stopped
+	if rollout.TargetVersion != "" {
+		for _, tenant := range all {
+			version, err := r.tenantVersion(tenant)
+			if err != nil {
+				return nil, err
+			}
+			report.Versions[tenant] = version
+		}
+	}
+	done := func(tenant string) bool {
+		version, ok := report.Versions[tenant]
+		return rollout.TargetVersion != "" && ok && version >= rollout.TargetVersion
+	}
+
+	var canary []string
+	isCanary := make(map[string]bool, len(rollout.Canary))
+	for _, tenant := range rollout.Canary {
+		isCanary[tenant] = true
+		if !done(tenant) {
+			canary = append(canary, tenant)
+		}
+	}
+	var remaining []string
+	for _, tenant := range tenants {
+		if !isCanary[tenant] && !done(tenant) {
+			remaining = append(remaining, tenant)
+		}
+	}
+
+	waves := splitWaves(remaining, rollout.WaveSize)
+	if len(canary) > 0 {
+		waves = append([][]string{canary}, waves...)
+	}
+
+	for i, wave := range waves {
+		if i > 0 && rollout.Pause > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(rollout.Pause):
+			}
+		}
+		if ctx.Err() != nil {
+			report.Halted = true
+			report.HaltReason = ctx.Err().Error()
+			break
+		}
+
+		results := r.runTenants(ctx, wave, ContinueOnFailure, fn)
+		report.Waves = append(report.Waves, results)
+
+		var failed int
+		for _, result := range results {
+			report.Versions[result.Tenant] = result.VersionAfter
+			if result.Err != nil {
+				failed++
+			}
+		}
+
+		if rate := float64(failed) / float64(len(results)); rate > rollout.MaxFailureRate {
+			report.Halted = true
+			report.HaltReason = fmt.Sprintf("wave %d failed on %d of %d tenants", i+1, failed, len(results))
+			break
+		}
+	}
+
+	// Report the version of the tenants the rollout did not reach
+	for _, tenant := range all {
+		if _, ok := report.Versions[tenant]; ok {
+			continue
+		}
+		version, err := r.tenantVersion(tenant)
+		if err != nil {
+			return report, err
+		}
+		report.Versions[tenant] = version
+	}
+
+	if report.Halted {
+		return report, fmt.Errorf("rollout halted: %s", report.HaltReason)
+	}
+
+	return report, nil
+}
+
+// tenantVersion returns the latest applied version of a tenant
+func (r *TenantRunner) tenantVersion(tenant string) (string, error) {
+	m, err := r.tenantMigrator(tenant)
+	if err != nil {
+		return "", err
+	}
+	return m.LatestVersion()
+}
+
+// splitWaves splits tenants into waves of the given size, or a single wave when size is not positive
+func splitWaves(tenants []string, size int) [][]string {
+	if len(tenants) == 0 {
+		return nil
+	}
+	if size <= 0 {
+		size = len(tenants)
+	}
+
+	var waves [][]string
+	for start := 0; start < len(tenants); start += size {
+		end := min(start+size, len(tenants))
+		waves = append(waves, tenants[start:end])
+	}
+
+	return waves
+}
@@ -0,0 +1,223 @@
+package migrator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	// scriptMigration is a pair of mongosh scripts
+	scriptMigration = "script"
+	// dataMigration is a directory of documents, loaded on up and deleted on down
+	dataMigration = "data"
+	// pipelineMigration is a pair of EJSON files declaring an update or aggregation pipeline
+	pipelineMigration = "pipeline"
+	// commandMigration is a pair of shell scripts, which may call any external tool
+	commandMigration = "command"
+)
+
+// migration groups the up and down scripts that share a version
+type migration struct {
+	Version string
+	// Kind selects the executor of the migration
+	Kind     string
+	UpPath   string
+	DownPath string
+	// Header holds the directives of the up script, DownHeader those of the down script
+	Header     header
+	DownHeader header
+}
+
+// loadMigrations reads the scripts directory and returns its migrations ordered by version
+func (m *Migrator) loadMigrations() ([]*migration, error) {
+	files, err := os.ReadDir(m.ScriptDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script directory: %w", err)
+	}
+
+	byVersion := make(map[string]*migration)
+	for _, file := range files {
+		if file.IsDir() {
+			version, ok := parseDataDirName(file.Name())
+			if !ok {
+				continue
+			}
+			if mig, exists := byVersion[version]; exists {
+				return nil, fmt.Errorf("version %s mixes %s and %s migrations", version, mig.Kind, dataMigration)
+			}
+			// Data migrations roll back by deleting the documents they loaded
+			dataPath := filepath.Join(m.ScriptDir, file.Name())
+			byVersion[version] = &migration{Version: version, Kind: dataMigration, UpPath: dataPath, DownPath: dataPath}
+			continue
+		}
+
+		// Files starting with an underscore are helpers, not migrations
+		kind, ok := scriptKind(file.Name())
+		if !ok || strings.HasPrefix(file.Name(), "_") || isRepeatable(file.Name()) {
+			continue
+		}
+
+		version, direction, ok := parseScriptName(file.Name())
+		if !ok {
+			continue
+		}
+
+		mig, exists := byVersion[version]
+		if !exists {
+			mig = &migration{Version: version, Kind: kind}
+			byVersion[version] = mig
+		}
+		if mig.Kind != kind {
+			return nil, fmt.Errorf("version %s mixes %s and %s migrations", version, mig.Kind, kind)
+		}
+
+		scriptPath := filepath.Join(m.ScriptDir, file.Name())
+		switch direction {
+		case "up":
+			mig.UpPath = scriptPath
+		case "down":
+			mig.DownPath = scriptPath
+		}
+	}
+
+	migrations := make([]*migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Kind == dataMigration {
+			mig.Header.Tags = nameTags(filepath.Base(mig.UpPath))
+			migrations = append(migrations, mig)
+			continue
+		}
+		if mig.UpPath != "" {
+			if mig.Header, err = m.parseHeader(mig.UpPath); err != nil {
+				return nil, err
+			}
+		}
+		if mig.DownPath != "" {
+			if mig.DownHeader, err = m.parseHeader(mig.DownPath); err != nil {
+				return nil, err
+			}
+		}
+		migrations = append(migrations, mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// checksum returns the checksum of the up script, or of the data files of a data migration
+func (mig *migration) checksum() (string, error) {
+	if mig.Kind == dataMigration {
+		return dirChecksum(mig.UpPath)
+	}
+	return fileChecksum(mig.UpPath)
+}
+
+// scriptKind returns the kind of migration a script file holds, judging by its extension
+func scriptKind(fileName string) (string, bool) {
+	switch filepath.Ext(fileName) {
+	case ".js":
+		return scriptMigration, true
+	case ".json":
+		return pipelineMigration, true
+	case ".sh":
+		return commandMigration, true
+	}
+	return "", false
+}
+
+// outcome is what a migration step reports for its record
+type outcome struct {
+	Output   string
+	Matched  int64
+	Modified int64
+}
+
+// stepFunc executes a prepared migration step
+type stepFunc func() (outcome, error)
+
+// prepare runs the checks of the up or down step of a migration that precede any write, such as its server version
+// constraint, its placeholders or the parsing of its documents, and returns the function executing the step.
+// The returned cleanup function must be called once the step ran.
+func (m *Migrator) prepare(mig *migration, direction string) (stepFunc, func(), error) {
+	path, hdr := mig.UpPath, mig.Header
+	if direction == "down" {
+		path, hdr = mig.DownPath, mig.DownHeader
+	}
+
+	var run stepFunc
+	var err error
+	switch mig.Kind {
+	case dataMigration:
+		run, err = m.dataStep(path, direction)
+	case pipelineMigration:
+		run, err = m.pipelineStep(path, hdr)
+	case commandMigration:
+		run, err = m.commandStep(path, hdr, mig.Version, direction)
+	default:
+		return m.scriptStep(path, hdr)
+	}
+	return run, func() {}, err
+}
+
+// check runs the checks of prepare, so a plan is rejected before any of its migrations ran
+func (m *Migrator) check(mig *migration, direction string) error {
+	_, cleanup, err := m.prepare(mig, direction)
+	if err != nil {
+		return err
+	}
+	cleanup()
+	return nil
+}
+
+// execute prepares and runs the up or down step of a migration, marking its record dirty right before the step starts
+func (m *Migrator) execute(mig *migration, direction string) (outcome, error) {
+	run, cleanup, err := m.prepare(mig, direction)
+	if err != nil {
+		return outcome{}, err
+	}
+	defer cleanup()
+
+	if err := m.setDirty(mig.Version, direction); err != nil {
+		return outcome{}, err
+	}
+
+	out, err := run()
+	if err != nil {
+		m.recordFailure(mig.Version, err)
+		return out, withMigration(err, mig.Version, direction)
+	}
+	return out, nil
+}
+
+// parseScriptName splits a script filename such as 001_up_create_users.js or 010_up@staging.js into its version and direction
+func parseScriptName(fileName string) (version, direction string, ok bool) {
+	name, _, _ := strings.Cut(strings.TrimSuffix(fileName, filepath.Ext(fileName)), "@")
+	parts := strings.SplitN(name, "_", 3)
+	if len(parts) < 2 || parts[0] == "" {
+		return "", "", false
+	}
+
+	switch parts[1] {
+	case "up", "down":
+		return parts[0], parts[1], true
+	}
+
+	return "", "", false
+}
+
+// selected reports whether a script header passes the environment and tag filters of the migrator
+func (m *Migrator) selected(hdr header) bool {
+	if len(hdr.Environments) > 0 && !slices.Contains(hdr.Environments, m.Environment) {
+		return false
+	}
+	if hdr.hasAnyTag(m.ExcludeTags) {
+		return false
+	}
+	return len(m.Tags) == 0 || hdr.hasAnyTag(m.Tags)
+}
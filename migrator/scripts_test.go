@@ -0,0 +1,85 @@
+package migrator
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseScriptName(t *testing.T) {
+	tests := []struct {
+		fileName  string
+		version   string
+		direction string
+		ok        bool
+	}{
+		{"001_up_create_users.js", "001", "up", true},
+		{"001_down_create_users.js", "001", "down", true},
+		{"030_up_backfill_totals.json", "030", "up", true},
+		{"010_up_seed@staging@demo.js", "010", "up", true},
+		// Tags may directly follow the direction when the script has no description
+		{"010_up@staging.js", "010", "up", true},
+		{"010_down@staging@demo.sh", "010", "down", true},
+		{"010_up.js", "010", "up", true},
+		{"010_sideways_users.js", "", "", false},
+		{"_up_users.js", "", "", false},
+		{"users.js", "", "", false},
+	}
+
+	for _, tt := range tests {
+		version, direction, ok := parseScriptName(tt.fileName)
+		if version != tt.version || direction != tt.direction || ok != tt.ok {
+			t.Errorf("parseScriptName(%q) = %q, %q, %v, want %q, %q, %v", tt.fileName, version, direction, ok, tt.version, tt.direction, tt.ok)
+		}
+	}
+}
+
+func TestParseDataDirName(t *testing.T) {
+	tests := []struct {
+		dirName string
+		version string
+		ok      bool
+	}{
+		{"020_data_countries", "020", true},
+		{"020_data_countries@staging", "020", true},
+		{"020_data@staging", "020", true},
+		{"020_data", "020", true},
+		{"020_up_countries", "", false},
+		{"squashed", "", false},
+	}
+
+	for _, tt := range tests {
+		version, ok := parseDataDirName(tt.dirName)
+		if version != tt.version || ok != tt.ok {
+			t.Errorf("parseDataDirName(%q) = %q, %v, want %q, %v", tt.dirName, version, ok, tt.version, tt.ok)
+		}
+	}
+}
+
+func TestLoadMigrationsTags(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"010_up@staging.js", "020_up_upgrade_to_v1.2.js"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("db.users.find();\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "030_data_countries@staging@demo"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	migrations, err := (&Migrator{ScriptDir: dir}).loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{"010": {"staging"}, "020": nil, "030": {"staging", "demo"}}
+	if len(migrations) != len(want) {
+		t.Fatalf("loadMigrations() = %v, want versions 010, 020 and 030", versionsOf(migrations))
+	}
+	for _, mig := range migrations {
+		if !slices.Equal(mig.Header.Tags, want[mig.Version]) {
+			t.Errorf("tags of %s = %v, want %v", mig.Version, mig.Header.Tags, want[mig.Version])
+		}
+	}
+}
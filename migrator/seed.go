@@ -0,0 +1,229 @@
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// seedCollection tracks applied seeds separately from the migrations collection
+const seedCollection = "seeds"
+
+// SeedRecord is a document in the seeds collection
+type SeedRecord struct {
+	// Name is the path of the seed relative to the seeds directory, e.g. staging/users.json
+	Name        string    `bson:"name"`
+	Environment string    `bson:"environment,omitempty"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+	Checksum    string    `bson:"checksum"`
+	// Documents is how many documents a data seed upserted
+	Documents int    `bson:"documents,omitempty"`
+	Output    string `bson:"output,omitempty"`
+	Stream    string `bson:"stream,omitempty"`
+}
+
+// seed is a data file or mongosh script of the seeds directory
+type seed struct {
+	Name string
+	Path string
+}
+
+// seedDir returns the directory holding seeds, by default the seeds directory of ScriptDir
+func (m *Migrator) seedDir() string {
+	if m.SeedDir != "" {
+		return m.SeedDir
+	}
+	return filepath.Join(m.ScriptDir, "seeds")
+}
+
+// loadSeeds returns the seeds shared by all environments followed by those of the current environment, each ordered by name
+func (m *Migrator) loadSeeds() ([]*seed, error) {
+	dirs := []string{""}
+	if m.Environment != "" {
+		dirs = append(dirs, m.Environment)
+	}
+
+	var seeds []*seed
+	for _, dir := range dirs {
+		files, err := os.ReadDir(filepath.Join(m.seedDir(), dir))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read seed directory: %w", err)
+		}
+
+		for _, file := range files {
+			if file.IsDir() || !isSeed(file.Name()) {
+				continue
+			}
+			name := filepath.ToSlash(filepath.Join(dir, file.Name()))
+			seeds = append(seeds, &seed{
+				Name: name,
+				Path: filepath.Join(m.seedDir(), dir, file.Name()),
+			})
+		}
+	}
+
+	return seeds, nil
+}
+
+// isSeed reports whether a filename names a seed, an EJSON data file or a mongosh script
+func isSeed(fileName string) bool {
+	if strings.HasPrefix(fileName, "_") {
+		return false
+	}
+	switch filepath.Ext(fileName) {
+	case ".json", ".js":
+		return true
+	}
+	return false
+}
+
+// Seed applies the seeds that were never applied or whose content changed since they were.
+// With ReportNoChange set, it returns ErrNoChange when every seed is up to date.
+func (m *Migrator) Seed() error {
+	return m.noChange(m.seed(false))
+}
+
+// Reseed applies every seed again, whether or not it changed
+func (m *Migrator) Reseed() error {
+	return m.noChange(m.seed(true))
+}
+
+// seed applies the seeds of the shared and the current environment directories while holding the migration lock
+func (m *Migrator) seed(force bool) error {
+	release, err := m.lock()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	seeds, err := m.loadSeeds()
+	if err != nil {
+		return err
+	}
+
+	records, err := m.SeedHistory()
+	if err != nil {
+		return err
+	}
+	checksums := make(map[string]string, len(records))
+	for _, record := range records {
+		checksums[record.Name] = record.Checksum
+	}
+
+	var applied int
+	for _, s := range seeds {
+		checksum, err := fileChecksum(s.Path)
+		if err != nil {
+			return err
+		}
+		if !force && checksums[s.Name] == checksum {
+			m.logger().Debug("seed unchanged, skipping", "seed", s.Name)
+			continue
+		}
+
+		start := time.Now()
+		record, err := m.applySeed(s)
+		if err != nil {
+			m.logger().Error("seed failed", "seed", s.Name, "duration", time.Since(start), "error", err)
+			return err
+		}
+		m.logger().Info("seed applied", "seed", s.Name, "documents", record.Documents, "duration", time.Since(start))
+
+		record.Checksum = checksum
+		if err := m.recordSeed(record); err != nil {
+			return err
+		}
+		applied++
+	}
+
+	if applied == 0 {
+		return ErrNoChange
+	}
+	return nil
+}
+
+// applySeed upserts the documents of a data seed or runs a script seed with mongosh
+func (m *Migrator) applySeed(s *seed) (SeedRecord, error) {
+	record := SeedRecord{Name: s.Name}
+
+	if filepath.Ext(s.Path) == ".js" {
+		hdr, err := m.parseHeader(s.Path)
+		if err != nil {
+			return record, err
+		}
+		record.Output, err = m.runScript(s.Path, hdr)
+		return record, err
+	}
+
+	documents, err := readDataFile(s.Path)
+	if err != nil {
+		return record, err
+	}
+
+	collectionName := strings.TrimSuffix(filepath.Base(s.Path), filepath.Ext(s.Path))
+	collection := m.dbClient.Database(m.DBName).Collection(collectionName)
+
+	models := make([]mongo.WriteModel, 0, len(documents))
+	for i, doc := range documents {
+		id, ok := documentID(doc)
+		if !ok {
+			return record, fmt.Errorf("seed %s: document %d has no _id to upsert by", s.Name, i)
+		}
+		models = append(models, mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": id}).SetReplacement(doc).SetUpsert(true))
+	}
+	if len(models) == 0 {
+		return record, nil
+	}
+
+	if _, err := collection.BulkWrite(context.Background(), models, options.BulkWrite().SetOrdered(true)); err != nil {
+		return record, fmt.Errorf("failed to apply seed %s: %w", s.Name, err)
+	}
+	record.Documents = len(models)
+
+	return record, nil
+}
+
+// recordSeed stores the latest application of a seed
+func (m *Migrator) recordSeed(record SeedRecord) error {
+	collection := m.dbClient.Database(m.DBName).Collection(seedCollection)
+
+	record.AppliedAt = time.Now()
+	record.Environment = m.Environment
+	record.Stream = m.Stream
+
+	_, err := collection.ReplaceOne(context.Background(), m.scope(bson.M{"name": record.Name}), record, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to record seed: %w", err)
+	}
+
+	return nil
+}
+
+// SeedHistory returns the records in the seeds collection ordered by name
+func (m *Migrator) SeedHistory() ([]SeedRecord, error) {
+	collection := m.dbClient.Database(m.DBName).Collection(seedCollection)
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := collection.Find(context.Background(), m.scope(bson.M{}), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch seed history: %w", err)
+	}
+	defer cursor.Close(context.Background())
+
+	var records []SeedRecord
+	if err := cursor.All(context.Background(), &records); err != nil {
+		return nil, fmt.Errorf("failed to decode seed history: %w", err)
+	}
+
+	return records, nil
+}
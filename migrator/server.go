@@ -0,0 +1,140 @@
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// serverVersion returns the version of the connected MongoDB server
+func (m *Migrator) serverVersion() (string, error) {
+	// Migrations may run concurrently when Workers is set
+	m.mongoVersionMu.Lock()
+	defer m.mongoVersionMu.Unlock()
+
+	if m.mongoVersion != "" {
+		return m.mongoVersion, nil
+	}
+
+	var result struct {
+		Version string `bson:"version"`
+	}
+	err := m.dbClient.Database("admin").RunCommand(context.Background(), bson.D{{Key: "buildInfo", Value: 1}}).Decode(&result)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch server version: %w", err)
+	}
+
+	m.mongoVersion = result.Version
+	return m.mongoVersion, nil
+}
+
+// checkServerVersion verifies that the connected server satisfies a constraint such as >=6.0
+func (m *Migrator) checkServerVersion(constraint string) error {
+	if constraint == "" {
+		return nil
+	}
+
+	op, want, err := parseVersionConstraint(constraint)
+	if err != nil {
+		return err
+	}
+
+	version, err := m.serverVersion()
+	if err != nil {
+		return err
+	}
+
+	got, err := parseVersion(version)
+	if err != nil {
+		return err
+	}
+
+	cmp := compareVersions(got, want)
+	var ok bool
+	switch op {
+	case ">=":
+		ok = cmp >= 0
+	case ">":
+		ok = cmp > 0
+	case "<=":
+		ok = cmp <= 0
+	case "<":
+		ok = cmp < 0
+	case "=":
+		ok = cmp == 0
+	}
+
+	if !ok {
+		return fmt.Errorf("server version %s does not satisfy %s", version, constraint)
+	}
+
+	return nil
+}
+
+// parseVersionConstraint splits a constraint such as >=6.0 into its operator and version
+func parseVersionConstraint(constraint string) (string, []int, error) {
+	constraint = strings.TrimSpace(constraint)
+
+	op := "="
+	for _, candidate := range []string{">=", "<=", "==", ">", "<", "="} {
+		if strings.HasPrefix(constraint, candidate) {
+			op = candidate
+			constraint = strings.TrimSpace(strings.TrimPrefix(constraint, candidate))
+			break
+		}
+	}
+
+	if op == "==" {
+		op = "="
+	}
+
+	version, err := parseVersion(constraint)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid version constraint %q: %w", constraint, err)
+	}
+
+	return op, version, nil
+}
+
+// parseVersion parses a dotted version such as 6.0.3 into its numeric components
+func parseVersion(version string) ([]int, error) {
+	// Drop suffixes such as -rc0 or -ent
+	version, _, _ = strings.Cut(version, "-")
+	if version == "" {
+		return nil, fmt.Errorf("empty version")
+	}
+
+	var parts []int
+	for _, part := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q", version)
+		}
+		parts = append(parts, n)
+	}
+
+	return parts, nil
+}
+
+// compareVersions returns -1, 0 or 1, treating missing components as zero
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,82 @@
+package migrator
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseVersionConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		op         string
+		version    []int
+		wantErr    bool
+	}{
+		{">=6.0", ">=", []int{6, 0}, false},
+		{"> 5.0.3", ">", []int{5, 0, 3}, false},
+		{"<=7", "<=", []int{7}, false},
+		{"<4.4", "<", []int{4, 4}, false},
+		{"==6.0", "=", []int{6, 0}, false},
+		{"=6.0", "=", []int{6, 0}, false},
+		{"6.0", "=", []int{6, 0}, false},
+		{" >= 7.0.0-rc1 ", ">=", []int{7, 0, 0}, false},
+		{">=", "", nil, true},
+		{">=six", "", nil, true},
+		{"6..0", "", nil, true},
+		{"", "", nil, true},
+	}
+
+	for _, tt := range tests {
+		op, version, err := parseVersionConstraint(tt.constraint)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseVersionConstraint(%q) error = %v, want error %v", tt.constraint, err, tt.wantErr)
+			continue
+		}
+		if op != tt.op || !slices.Equal(version, tt.version) {
+			t.Errorf("parseVersionConstraint(%q) = %q, %v, want %q, %v", tt.constraint, op, version, tt.op, tt.version)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b []int
+		want int
+	}{
+		{[]int{6, 0}, []int{6, 0, 0}, 0},
+		{[]int{6, 0, 1}, []int{6, 0}, 1},
+		{[]int{5, 10}, []int{6}, -1},
+		{[]int{10}, []int{9, 9}, 1},
+	}
+
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%v, %v) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCheckServerVersion(t *testing.T) {
+	tests := []struct {
+		constraint string
+		wantErr    bool
+	}{
+		{"", false},
+		{">=6.0", false},
+		{">6.0.5", true},
+		{"<7", false},
+		{"<=6.0.5", false},
+		{"=6.0.5", false},
+		{"=6.0", true},
+		{">=7.0", true},
+		{"invalid", true},
+	}
+
+	// A cached server version keeps the check from querying a server
+	m := &Migrator{mongoVersion: "6.0.5-ent"}
+	for _, tt := range tests {
+		if err := m.checkServerVersion(tt.constraint); (err != nil) != tt.wantErr {
+			t.Errorf("checkServerVersion(%q) error = %v, want error %v", tt.constraint, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package migrator
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	squashedDir    = "squashed"
+	squashedMarker = "squashed"
+)
+
+// Squash consolidates the migrations between from and to (inclusive) into a single baseline migration.
+// The consolidated scripts are named after the last version in the range, so databases that already
+// applied the range skip them while fresh databases run only the baseline. The original scripts are
+// moved into the squashed subdirectory, which is ignored when loading migrations.
+func (m *Migrator) Squash(from, to string) (string, error) {
+	if from == "" || to == "" || from >= to {
+		return "", fmt.Errorf("invalid squash range %s-%s", from, to)
+	}
+
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return "", err
+	}
+
+	var inRange []*migration
+	for _, mig := range migrations {
+		if mig.Version >= from && mig.Version <= to {
+			inRange = append(inRange, mig)
+		}
+	}
+
+	if len(inRange) < 2 || inRange[0].Version != from || inRange[len(inRange)-1].Version != to {
+		return "", fmt.Errorf("squash range %s-%s must start and end with existing migrations", from, to)
+	}
+
+	var up, down bytes.Buffer
+	var sources []string
+	hasDown := true
+	for _, mig := range inRange {
+		if mig.UpPath == "" {
+			return "", fmt.Errorf("migration %s has no up script", mig.Version)
+		}
+		if mig.Kind != scriptMigration {
+			return "", fmt.Errorf("migration %s is a %s migration, only scripts can be squashed", mig.Version, mig.Kind)
+		}
+		if mig.DownPath == "" {
+			hasDown = false
+		}
+		if err := appendScript(&up, mig.UpPath); err != nil {
+			return "", err
+		}
+		sources = append(sources, mig.UpPath)
+	}
+
+	// Down scripts are concatenated in reverse order so the rollback undoes the newest change first
+	if hasDown {
+		for i := len(inRange) - 1; i >= 0; i-- {
+			if err := appendScript(&down, inRange[i].DownPath); err != nil {
+				return "", err
+			}
+			sources = append(sources, inRange[i].DownPath)
+		}
+	}
+
+	archiveDir := filepath.Join(m.ScriptDir, squashedDir)
+	if err := os.MkdirAll(archiveDir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create squash archive directory: %w", err)
+	}
+
+	upPath := filepath.Join(m.ScriptDir, squashedScriptName(from, to, "up"))
+	if err := os.WriteFile(upPath, up.Bytes(), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write squashed script: %w", err)
+	}
+
+	if hasDown {
+		downPath := filepath.Join(m.ScriptDir, squashedScriptName(from, to, "down"))
+		if err := os.WriteFile(downPath, down.Bytes(), 0o644); err != nil {
+			return "", fmt.Errorf("failed to write squashed script: %w", err)
+		}
+	} else {
+		m.logger().Warn("not every squashed migration has a down script, the squashed migration will not be reversible", "from", from, "to", to)
+	}
+
+	for _, source := range sources {
+		if err := os.Rename(source, filepath.Join(archiveDir, filepath.Base(source))); err != nil {
+			return "", fmt.Errorf("failed to archive script %s: %w", source, err)
+		}
+	}
+
+	return upPath, nil
+}
+
+// appendScript appends the content of a script to the buffer, preceded by a comment naming its source file.
+// The directives of its header are disabled, they describe the single script and must not apply to the whole squash.
+// Each script is wrapped in its own block, so top level const, let and class declarations of scripts that used to run
+// in separate mongosh processes do not collide.
+func appendScript(buf *bytes.Buffer, scriptPath string) error {
+	content, err := os.ReadFile(scriptPath)
+	if err != nil {
+		return fmt.Errorf("failed to read script %s: %w", scriptPath, err)
+	}
+
+	fmt.Fprintf(buf, "// --- %s ---\n{\n", filepath.Base(scriptPath))
+	buf.Write(disableDirectives(content))
+	if !bytes.HasSuffix(content, []byte("\n")) {
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n\n")
+
+	return nil
+}
+
+// disableDirectives turns the directives in the header of a script into plain comments
+func disableDirectives(content []byte) []byte {
+	lines := strings.SplitAfter(string(content), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		comment, ok := headerComment(trimmed)
+		if !ok {
+			break
+		}
+		if strings.HasPrefix(comment, "@") {
+			lines[i] = "// squashed " + comment + line[len(strings.TrimRight(line, "\r\n")):]
+		}
+	}
+	return []byte(strings.Join(lines, ""))
+}
+
+// squashedScriptName returns the filename of a squashed script, e.g. 150_up_squashed_001_150.js
+func squashedScriptName(from, to, direction string) string {
+	return fmt.Sprintf("%s_%s_%s_%s_%s.js", to, direction, squashedMarker, from, to)
+}
+
+// squashedRange returns the first and last version consolidated into a squashed script
+func squashedRange(scriptPath string) (from, to string, ok bool) {
+	name := strings.TrimSuffix(filepath.Base(scriptPath), filepath.Ext(scriptPath))
+	parts := strings.Split(name, "_")
+	if len(parts) != 5 || parts[2] != squashedMarker || parts[0] != parts[4] {
+		return "", "", false
+	}
+
+	return parts[3], parts[4], true
+}
+
+// checkSquashedRange makes sure a database has applied either none or all of a squashed range
+func checkSquashedRange(mig *migration, appliedMigrations map[string]bool) error {
+	from, to, ok := squashedRange(mig.UpPath)
+	if !ok {
+		return nil
+	}
+
+	for version := range appliedMigrations {
+		if version >= from && version < to {
+			return fmt.Errorf("squashed migrations %s-%s are partially applied, apply the original scripts first", from, to)
+		}
+	}
+
+	return nil
+}
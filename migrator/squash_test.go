@@ -0,0 +1,111 @@
+package migrator
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestSquashedRange(t *testing.T) {
+	tests := []struct {
+		path     string
+		from, to string
+		ok       bool
+	}{
+		{"150_up_squashed_001_150.js", "001", "150", true},
+		{filepath.Join("scripts", "150_down_squashed_001_150.js"), "001", "150", true},
+		{squashedScriptName("010", "020", "up"), "010", "020", true},
+		{"150_up_create_users.js", "", "", false},
+		{"150_up_squashed_users.js", "", "", false},
+		// The squashed migration is named after the last version of its range
+		{"149_up_squashed_001_150.js", "", "", false},
+		{"150_up_squashed_001_150_extra.js", "", "", false},
+		{"", "", "", false},
+	}
+
+	for _, tt := range tests {
+		from, to, ok := squashedRange(tt.path)
+		if from != tt.from || to != tt.to || ok != tt.ok {
+			t.Errorf("squashedRange(%q) = %q, %q, %v, want %q, %q, %v", tt.path, from, to, ok, tt.from, tt.to, tt.ok)
+		}
+	}
+}
+
+func TestCheckSquashedRange(t *testing.T) {
+	squash := &migration{Version: "150", UpPath: squashedScriptName("001", "150", "up")}
+
+	tests := []struct {
+		name    string
+		mig     *migration
+		applied map[string]bool
+		wantErr bool
+	}{
+		{"fresh database", squash, map[string]bool{}, false},
+		{"versions before the range", squash, map[string]bool{"000": true}, false},
+		{"partially applied range", squash, map[string]bool{"001": true, "002": true}, true},
+		{"last original applied only", squash, map[string]bool{"149": true}, true},
+		{"not a squash", &migration{Version: "151", UpPath: "151_up_add_index.js"}, map[string]bool{"001": true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSquashedRange(tt.mig, tt.applied)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkSquashedRange() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDisableDirectives(t *testing.T) {
+	script := "// @env staging\n  // @timeout 1m\n// a comment\n\n// @transaction\r\ndb.users.insertOne({});\n// @no-down\n"
+	want := "// squashed @env staging\n// squashed @timeout 1m\n// a comment\n\n// squashed @transaction\r\ndb.users.insertOne({});\n// @no-down\n"
+
+	if got := string(disableDirectives([]byte(script))); got != want {
+		t.Errorf("disableDirectives() = %q, want %q", got, want)
+	}
+}
+
+func TestSquashScopesScripts(t *testing.T) {
+	dir := t.TempDir()
+	scripts := map[string]string{
+		"001_up_create_users.js":   "// @description create users\nconst users = db.users;\nusers.insertOne({});\n",
+		"001_down_create_users.js": "const users = db.users;\nusers.drop();\n",
+		"002_up_index_users.js":    "const users = db.users;\nusers.createIndex({ email: 1 });",
+		"002_down_index_users.js":  "const users = db.users;\nusers.dropIndex({ email: 1 });\n",
+	}
+	for name, content := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &Migrator{ScriptDir: dir}
+	upPath, err := m.Squash("001", "002")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	up, err := os.ReadFile(upPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "// --- 001_up_create_users.js ---\n{\n// squashed @description create users\nconst users = db.users;\nusers.insertOne({});\n}\n\n" +
+		"// --- 002_up_index_users.js ---\n{\nconst users = db.users;\nusers.createIndex({ email: 1 });\n}\n\n"
+	if string(up) != want {
+		t.Errorf("squashed up script = %q, want %q", up, want)
+	}
+
+	// The squashed scripts redeclare users, which is only valid when each of them has its own block
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node is not installed, skipping the syntax check")
+	}
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(dir, squashedScriptName("001", "002", direction))
+		if output, err := exec.Command(node, "--check", path).CombinedOutput(); err != nil {
+			t.Errorf("squashed %s script is not valid JavaScript: %v\n%s", direction, err, output)
+		}
+	}
+}
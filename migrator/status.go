@@ -0,0 +1,68 @@
+package migrator
+
+import (
+	"sort"
+)
+
+// Status describes the schema state of the database compared to the scripts directory
+type Status struct {
+	// Stream is the migration stream the status describes, empty for the default stream
+	Stream string `json:"stream,omitempty"`
+	// CurrentVersion is the highest applied version, empty when nothing was applied
+	CurrentVersion string `json:"currentVersion"`
+	// Pending lists the versions that Up would apply
+	Pending []string `json:"pending"`
+	// SkippedByFilter lists the versions that are not applied because the tag or environment filters exclude them
+	SkippedByFilter []string `json:"skippedByFilter"`
+	// Dirty is set when a previous run stopped halfway through DirtyVersion
+	Dirty        bool   `json:"dirty"`
+	DirtyVersion string `json:"dirtyVersion,omitempty"`
+	// Lock is the lock of the run in progress, nil when no run holds it
+	Lock *LockInfo `json:"lock,omitempty"`
+}
+
+// Status compares the applied migrations with the scripts directory
+func (m *Migrator) Status() (*Status, error) {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	appliedMigrations, err := m.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{Stream: m.Stream, Pending: []string{}, SkippedByFilter: []string{}}
+
+	applied := make([]string, 0, len(appliedMigrations))
+	for version := range appliedMigrations {
+		applied = append(applied, version)
+	}
+	sort.Strings(applied)
+	if len(applied) > 0 {
+		status.CurrentVersion = applied[len(applied)-1]
+	}
+
+	for _, mig := range migrations {
+		if mig.UpPath == "" || appliedMigrations[mig.Version] {
+			continue
+		}
+		if m.selected(mig.Header) {
+			status.Pending = append(status.Pending, mig.Version)
+		} else {
+			status.SkippedByFilter = append(status.SkippedByFilter, mig.Version)
+		}
+	}
+
+	if status.DirtyVersion, err = m.dirtyVersion(); err != nil {
+		return nil, err
+	}
+	status.Dirty = status.DirtyVersion != ""
+
+	if status.Lock, err = m.LockHolder(); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
@@ -0,0 +1,24 @@
+package migrator
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// scope restricts a filter on the migrations collection to the stream of the migrator.
+// Records of the default stream have no stream field, which a nil value matches.
+func (m *Migrator) scope(filter bson.M) bson.M {
+	if m.Stream == "" {
+		filter["stream"] = nil
+	} else {
+		filter["stream"] = m.Stream
+	}
+	return filter
+}
+
+// lockID returns the id of the lock document of the migrator's stream, so streams never block each other
+func (m *Migrator) lockID() string {
+	if m.Stream == "" {
+		return lockID
+	}
+	return lockID + ":" + m.Stream
+}
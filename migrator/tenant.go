@@ -0,0 +1,253 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FailurePolicy decides what a TenantRunner does when a tenant fails
+type FailurePolicy int
+
+const (
+	// StopOnFailure stops starting new tenants after the first failure
+	StopOnFailure FailurePolicy = iota
+	// ContinueOnFailure keeps migrating the remaining tenants
+	ContinueOnFailure
+)
+
+// TenantRunner applies the same migrations to many databases over a shared client.
+// Every tenant has its own migrations collection and lock.
+type TenantRunner struct {
+	ScriptDir          string
+	MongoClientOptions *options.ClientOptions
+	// Tenants lists the databases to migrate. When empty, the databases of the server are listed
+	// and filtered by TenantFilter and TenantPattern, never including the admin, config and local databases.
+	Tenants       []string
+	TenantFilter  bson.M
+	TenantPattern *regexp.Regexp
+	// Concurrency is how many tenants are migrated at once, defaults to 1
+	Concurrency   int
+	FailurePolicy FailurePolicy
+	// Configure is called with the migrator of every tenant before it runs, e.g. to set Params or Hooks
+	Configure func(tenant string, m *Migrator)
+	// Logger is the logger of every tenant, with a tenant attribute added. It defaults to a text logger writing to stdout.
+	Logger   *slog.Logger
+	dbClient *mongo.Client
+}
+
+// RunResult is the outcome of a run on a single database, shared by tenant and cluster results
+type RunResult struct {
+	VersionBefore string
+	VersionAfter  string
+	// Changed is false when there was nothing to do
+	Changed  bool
+	Duration time.Duration
+	Err      error
+}
+
+// TenantResult is the outcome of a run on a single tenant
+type TenantResult struct {
+	Tenant string
+	// Skipped is set for tenants that were not started because an earlier tenant failed
+	Skipped bool
+	RunResult
+}
+
+// NewTenantRunner creates a TenantRunner sharing an already connected client
+func NewTenantRunner(client *mongo.Client, mongoClientOptions *options.ClientOptions, scriptDir string) *TenantRunner {
+	return &TenantRunner{
+		ScriptDir:          scriptDir,
+		MongoClientOptions: mongoClientOptions,
+		Concurrency:        1,
+		dbClient:           client,
+	}
+}
+
+// Up applies pending migrations to every tenant
+func (r *TenantRunner) Up(ctx context.Context) ([]TenantResult, error) {
+	return r.Run(ctx, (*Migrator).Up)
+}
+
+// Run calls fn with the migrator of every tenant and returns the result of each tenant in tenant order.
+// The migrators have ReportNoChange set, fn returns ErrNoChange when a tenant had nothing to do.
+// The returned error joins the errors of all failed tenants, and the error of ctx when it ended before every tenant was started.
+func (r *TenantRunner) Run(ctx context.Context, fn func(*Migrator) error) ([]TenantResult, error) {
+	tenants, err := r.tenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := r.runTenants(ctx, tenants, r.FailurePolicy, fn)
+	err = tenantErrors(results)
+
+	// Tenants skipped after a failure are covered by its error, those skipped because ctx ended are not
+	if ctx.Err() != nil {
+		for _, result := range results {
+			if result.Skipped {
+				return results, errors.Join(err, fmt.Errorf("tenants were skipped: %w", ctx.Err()))
+			}
+		}
+	}
+
+	return results, err
+}
+
+// runTenants migrates the given tenants with the configured concurrency and the given failure policy
+func (r *TenantRunner) runTenants(ctx context.Context, tenants []string, policy FailurePolicy, fn func(*Migrator) error) []TenantResult {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	concurrency := r.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]TenantResult, len(tenants))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, tenant := range tenants {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			results[i] = TenantResult{Tenant: tenant, Skipped: true, RunResult: RunResult{Err: ctx.Err()}}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, tenant string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i] = r.runTenant(tenant, fn)
+			if results[i].Err != nil && policy == StopOnFailure {
+				cancel()
+			}
+		}(i, tenant)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// runTenant runs fn on a single tenant and records its versions before and after
+func (r *TenantRunner) runTenant(tenant string, fn func(*Migrator) error) TenantResult {
+	open := func() (*Migrator, func(), error) {
+		m, err := r.tenantMigrator(tenant)
+		return m, func() {}, err
+	}
+	return TenantResult{Tenant: tenant, RunResult: runMigrator("tenant "+tenant, open, fn)}
+}
+
+// runMigrator opens a migrator, runs fn on it and records the latest version before and after.
+// The close function returned by open is called once the versions are read. Errors are prefixed with name.
+func runMigrator(name string, open func() (*Migrator, func(), error), fn func(*Migrator) error) (result RunResult) {
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+		if result.Err != nil {
+			result.Err = fmt.Errorf("%s: %w", name, result.Err)
+		}
+	}()
+
+	m, closeMigrator, err := open()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer closeMigrator()
+	// Changed is told apart from a run that had nothing to do by ErrNoChange
+	m.ReportNoChange = true
+
+	if result.VersionBefore, err = m.LatestVersion(); err != nil {
+		result.Err = err
+		return result
+	}
+
+	err = fn(m)
+	switch {
+	case errors.Is(err, ErrNoChange):
+	case err != nil:
+		result.Err = err
+	default:
+		result.Changed = true
+	}
+
+	after, versionErr := m.LatestVersion()
+	if versionErr != nil && result.Err == nil {
+		result.Err = versionErr
+	}
+	result.VersionAfter = after
+
+	return result
+}
+
+// tenantMigrator returns the configured migrator of a tenant
+func (r *TenantRunner) tenantMigrator(tenant string) (*Migrator, error) {
+	m, err := NewMigratorWithClient(r.dbClient, r.MongoClientOptions, tenant, r.ScriptDir)
+	if err != nil {
+		return nil, err
+	}
+	m.Logger = loggerOrDefault(r.Logger).With("tenant", tenant)
+	if r.Configure != nil {
+		r.Configure(tenant, m)
+	}
+	return m, nil
+}
+
+// tenants returns the configured tenants, or the matching databases of the server
+func (r *TenantRunner) tenants(ctx context.Context) ([]string, error) {
+	if len(r.Tenants) > 0 {
+		return r.Tenants, nil
+	}
+
+	filter := r.TenantFilter
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	names, err := r.dbClient.ListDatabaseNames(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenant databases: %w", err)
+	}
+
+	var tenants []string
+	for _, name := range names {
+		if systemDatabases[name] {
+			continue
+		}
+		if r.TenantPattern == nil || r.TenantPattern.MatchString(name) {
+			tenants = append(tenants, name)
+		}
+	}
+	sort.Strings(tenants)
+
+	return tenants, nil
+}
+
+// systemDatabases are the databases of the server itself, which are never listed as tenants
+var systemDatabases = map[string]bool{"admin": true, "config": true, "local": true}
+
+// tenantErrors joins the errors of the failed tenants, or returns nil when every tenant succeeded.
+// The errors of skipped tenants are left out, they only repeat why the run stopped.
+func tenantErrors(results []TenantResult) error {
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil && !result.Skipped {
+			errs = append(errs, result.Err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,36 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRunReportsEndedContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := &TenantRunner{Tenants: []string{"tenant_a", "tenant_b"}}
+	results, err := r.Run(ctx, (*Migrator).Up)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v, want context.Canceled", err)
+	}
+	for _, result := range results {
+		if !result.Skipped {
+			t.Errorf("tenant %s was not skipped", result.Tenant)
+		}
+	}
+}
+
+func TestTenantErrorsHidesSkippedTenants(t *testing.T) {
+	failure := errors.New("tenant tenant_a: failed")
+	results := []TenantResult{
+		{Tenant: "tenant_a", RunResult: RunResult{Err: failure}},
+		{Tenant: "tenant_b", Skipped: true, RunResult: RunResult{Err: context.Canceled}},
+	}
+
+	err := tenantErrors(results)
+	if !errors.Is(err, failure) || errors.Is(err, context.Canceled) {
+		t.Errorf("tenantErrors() = %v, want only the failure of tenant_a", err)
+	}
+}
@@ -2,16 +2,23 @@ package migrator
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
 )
 
-// Up applies all up migrations in the scripts directory that haven't been applied yet
+// Up applies all up migrations in the scripts directory that haven't been applied yet,
+// followed by the repeatable migrations whose content changed since their last run.
+// With ReportNoChange set, it returns ErrNoChange when there was nothing to apply.
 func (m *Migrator) Up() error {
-	files, err := os.ReadDir(m.ScriptDir)
+	return m.run("up", m.up)
+}
+
+func (m *Migrator) up() error {
+	if err := m.checkDirty(); err != nil {
+		return err
+	}
+
+	migrations, deps, err := m.plannedMigrations()
 	if err != nil {
-		return fmt.Errorf("failed to read script directory: %w", err)
+		return err
 	}
 
 	appliedMigrations, err := m.appliedMigrations()
@@ -19,24 +26,92 @@ func (m *Migrator) Up() error {
 		return err
 	}
 
-	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".js") && strings.Contains(file.Name(), "up") {
-			version := extractVersionFromFileName(file.Name())
-			if appliedMigrations[version] {
-				fmt.Printf("Migration %s already applied, skipping.\n", version)
-				continue
+	if m.RequireDown {
+		for _, mig := range migrations {
+			if mig.UpPath != "" && mig.DownPath == "" && !mig.Header.NoDown && !appliedMigrations[mig.Version] {
+				return fmt.Errorf("%w: migration %s has no down script, add one or mark it @no-down", ErrIrreversible, mig.Version)
 			}
+		}
+	}
 
-			scriptPath := filepath.Join(m.ScriptDir, file.Name())
-			if err := m.runScript(scriptPath); err != nil {
-				return err
+	var pending []*migration
+	for _, mig := range migrations {
+		if mig.UpPath == "" {
+			continue
+		}
+
+		if !m.selected(mig.Header) {
+			m.logger().Info("migration skipped by filter", "version", mig.Version, "tags", mig.Header.Tags, "environment", m.Environment)
+			continue
+		}
+
+		if appliedMigrations[mig.Version] {
+			m.logger().Debug("migration already applied, skipping", "version", mig.Version)
+			continue
+		}
+
+		if err := checkSquashedRange(mig, appliedMigrations); err != nil {
+			return err
+		}
+
+		pending = append(pending, mig)
+	}
+
+	// Every declared dependency must be applied already or be applied by this run
+	planned := make(map[string]bool, len(pending))
+	for _, mig := range pending {
+		planned[mig.Version] = true
+	}
+	for _, mig := range pending {
+		for _, dep := range mig.Header.DependsOn {
+			if !appliedMigrations[dep] && !planned[dep] {
+				return fmt.Errorf("migration %s depends on %s, which is neither applied nor selected", mig.Version, dep)
 			}
+		}
+	}
 
-			if err := m.recordMigration(version); err != nil {
+	// Checks such as @requires-server or placeholders fail before any migration runs or is marked dirty
+	plan := make([]string, 0, len(pending))
+	for _, mig := range pending {
+		if err := m.check(mig, "up"); err != nil {
+			return err
+		}
+		plan = append(plan, mig.Version)
+	}
+	m.emit(Event{Type: PlanComputed, Direction: "up", Plan: plan})
+
+	if m.Workers > 1 {
+		if err := m.applyConcurrently(pending, deps, appliedMigrations, m.applyUp); err != nil {
+			return err
+		}
+	} else {
+		for _, mig := range pending {
+			if err := m.applyUp(mig); err != nil {
 				return err
 			}
 		}
 	}
 
+	// Repeatable migrations run after all versioned migrations have been applied
+	repeated, err := m.runRepeatables()
+	if err != nil {
+		return err
+	}
+
+	if len(pending)+repeated == 0 {
+		return ErrNoChange
+	}
+
 	return nil
 }
+
+// applyUp runs the up script of a migration and records it as applied
+func (m *Migrator) applyUp(mig *migration) error {
+	return m.step("up", mig.Version, mig.UpPath, func() error {
+		out, err := m.execute(mig, "up")
+		if err != nil {
+			return err
+		}
+		return m.recordMigration(mig, out)
+	})
+}
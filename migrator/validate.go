@@ -0,0 +1,87 @@
+package migrator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Validate reports applied migrations whose script, or the helpers loaded with it, changed since they were applied
+func (m *Migrator) Validate() error {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	history, err := m.History()
+	if err != nil {
+		return err
+	}
+
+	helpersChecksum, err := m.helpersChecksum()
+	if err != nil {
+		return err
+	}
+
+	byVersion := make(map[string]*migration, len(migrations))
+	for _, mig := range migrations {
+		byVersion[mig.Version] = mig
+	}
+
+	var drifted []string
+	for _, record := range history {
+		mig := byVersion[record.Version]
+		// Baselined records carry no checksum, and squashed versions no longer have a script
+		if record.Version == "" || record.Checksum == "" || mig == nil || mig.UpPath == "" {
+			continue
+		}
+		checksum, err := mig.checksum()
+		if err != nil {
+			return err
+		}
+
+		// Databases that applied a squashed range hold the checksum of its original last script
+		if _, to, ok := squashedRange(mig.UpPath); ok && checksum != record.Checksum {
+			if checksum, err = m.archivedChecksum(to, record.Checksum); err != nil {
+				return err
+			}
+			// Without the archived scripts the record cannot be verified
+			if checksum == "" {
+				continue
+			}
+		}
+
+		// Only migrations that were applied with helpers depend on them
+		helpersChanged := record.HelpersChecksum != "" && record.HelpersChecksum != helpersChecksum
+		if checksum != record.Checksum || helpersChanged {
+			drifted = append(drifted, record.Version)
+		}
+	}
+
+	if len(drifted) > 0 {
+		return fmt.Errorf("%w: applied migrations changed on disk: %s", ErrChecksumMismatch, strings.Join(drifted, ", "))
+	}
+
+	return nil
+}
+
+// archivedChecksum returns want when an up script of the version archived by Squash has that checksum,
+// otherwise the checksum of one of them, or an empty string when none was archived
+func (m *Migrator) archivedChecksum(version, want string) (string, error) {
+	paths, err := filepath.Glob(filepath.Join(m.ScriptDir, squashedDir, version+"_up_*"))
+	if err != nil {
+		return "", fmt.Errorf("failed to list squashed scripts: %w", err)
+	}
+
+	var checksum string
+	for _, path := range paths {
+		if checksum, err = fileChecksum(path); err != nil {
+			return "", err
+		}
+		if checksum == want {
+			return checksum, nil
+		}
+	}
+
+	return checksum, nil
+}
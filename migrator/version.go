@@ -3,7 +3,6 @@ package migrator
 import (
 	"context"
 	"fmt"
-	"strings"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -15,9 +14,9 @@ func (m *Migrator) LatestVersion() (string, error) {
 	collection := m.dbClient.Database(m.DBName).Collection("migrations")
 
 	// Find the document with the highest version
-	opts := options.FindOne().SetSort(bson.D{{"version", -1}})
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
 	var result bson.M
-	err := collection.FindOne(context.Background(), bson.M{}, opts).Decode(&result)
+	err := collection.FindOne(context.Background(), m.scope(bson.M{"version": bson.M{"$exists": true}, "dirty": bson.M{"$ne": true}}), opts).Decode(&result)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			// No migrations have been applied yet
@@ -33,12 +32,3 @@ func (m *Migrator) LatestVersion() (string, error) {
 
 	return version, nil
 }
-
-// extractVersionFromFileName extracts the version from the migration script filename
-func extractVersionFromFileName(fileName string) string {
-	parts := strings.Split(fileName, "_")
-	if len(parts) > 0 {
-		return parts[0]
-	}
-	return ""
-}
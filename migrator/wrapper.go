@@ -0,0 +1,104 @@
+package migrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// writeWrapper writes a temporary script that connects to the migrated database, defines the params global, loads the helpers
+// and then the given script, inside a transaction when the header asks for one. The wrapper holds the connection
+// credentials, so it is only readable by the current user.
+func (m *Migrator) writeWrapper(scriptPath string, hdr header, helpers []string) (string, error) {
+	var wrapper bytes.Buffer
+
+	quotedURI, err := json.Marshal(m.connectionURI())
+	if err != nil {
+		return "", fmt.Errorf("failed to quote connection string: %w", err)
+	}
+	quotedDB, err := json.Marshal(m.DBName)
+	if err != nil {
+		return "", fmt.Errorf("failed to quote database name: %w", err)
+	}
+	// Scripts run against the database the migrations are recorded in, which may differ from the one in the URI
+	fmt.Fprintf(&wrapper, "db = connect(%s).getSiblingDB(%s);\n", quotedURI, quotedDB)
+
+	if m.Params != nil {
+		params, err := bson.MarshalExtJSON(m.Params, true, false)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode params: %w", err)
+		}
+		quotedParams, err := json.Marshal(string(params))
+		if err != nil {
+			return "", fmt.Errorf("failed to quote params: %w", err)
+		}
+		fmt.Fprintf(&wrapper, "globalThis.params = EJSON.parse(%s);\n", quotedParams)
+	}
+
+	for _, helper := range helpers {
+		quotedHelper, err := quotePath(helper)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&wrapper, "load(%s);\n", quotedHelper)
+	}
+
+	quotedPath, err := quotePath(scriptPath)
+	if err != nil {
+		return "", err
+	}
+
+	// The transaction is driven from a function scope with a reserved name, so the script may declare its own session
+	if hdr.Transaction {
+		fmt.Fprintf(&wrapper, `(function () {
+  const __migrongoSession = db.getMongo().startSession();
+  __migrongoSession.startTransaction();
+  try {
+    db = __migrongoSession.getDatabase(db.getName());
+    load(%s);
+    __migrongoSession.commitTransaction();
+  } catch (e) {
+    __migrongoSession.abortTransaction();
+    throw e;
+  } finally {
+    __migrongoSession.endSession();
+  }
+})();
+`, quotedPath)
+	} else {
+		fmt.Fprintf(&wrapper, "load(%s);\n", quotedPath)
+	}
+
+	// CreateTemp creates the file with 0600 permissions
+	file, err := os.CreateTemp("", "migrongo-*.js")
+	if err != nil {
+		return "", fmt.Errorf("failed to create wrapper script: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(wrapper.Bytes()); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write wrapper script: %w", err)
+	}
+
+	return file.Name(), nil
+}
+
+// quotePath returns the absolute path of a file as a JS string literal
+func quotePath(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve script path: %w", err)
+	}
+
+	quoted, err := json.Marshal(absPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to quote script path: %w", err)
+	}
+
+	return string(quoted), nil
+}